@@ -0,0 +1,94 @@
+package methods
+
+import (
+	"fmt"
+	"github.com/protolambda/go-eth2-reqresp/reqresp"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
+	"github.com/protolambda/ztyp/view"
+)
+
+// Deneb blob preset values, mainnet.
+const (
+	FIELD_ELEMENTS_PER_BLOB              = 4096
+	BYTES_PER_BLOB                       = FIELD_ELEMENTS_PER_BLOB * BYTES_PER_FIELD_ELEMENT
+	KZG_COMMITMENT_INCLUSION_PROOF_DEPTH = 17
+)
+
+type Blob [BYTES_PER_BLOB]byte
+
+func (b *Blob) Deserialize(dr *codec.DecodingReader) error {
+	_, err := dr.Read(b[:])
+	return err
+}
+
+func (b *Blob) Serialize(w *codec.EncodingWriter) error {
+	return w.Write(b[:])
+}
+
+func (Blob) ByteLength() uint64 {
+	return BYTES_PER_BLOB
+}
+
+func (Blob) FixedLength() uint64 {
+	return BYTES_PER_BLOB
+}
+
+type KZGCommitmentInclusionProof [KZG_COMMITMENT_INCLUSION_PROOF_DEPTH]common.Root
+
+func (p *KZGCommitmentInclusionProof) Deserialize(dr *codec.DecodingReader) error {
+	roots := p[:]
+	return tree.ReadRoots(dr, &roots, KZG_COMMITMENT_INCLUSION_PROOF_DEPTH)
+}
+
+func (p *KZGCommitmentInclusionProof) Serialize(w *codec.EncodingWriter) error {
+	return tree.WriteRoots(w, p[:])
+}
+
+func (KZGCommitmentInclusionProof) ByteLength() uint64 {
+	return KZG_COMMITMENT_INCLUSION_PROOF_DEPTH * 32
+}
+
+func (KZGCommitmentInclusionProof) FixedLength() uint64 {
+	return KZG_COMMITMENT_INCLUSION_PROOF_DEPTH * 32
+}
+
+// BlobSidecar is the deneb blob sidecar, also used in electra.
+type BlobSidecar struct {
+	Index                       view.Uint64View
+	Blob                        Blob
+	KZGCommitment               KZGCommitment
+	KZGProof                    KZGProof
+	SignedBlockHeader           common.SignedBeaconBlockHeader
+	KZGCommitmentInclusionProof KZGCommitmentInclusionProof
+}
+
+func (b *BlobSidecar) Deserialize(dr *codec.DecodingReader) error {
+	return dr.FixedLenContainer(&b.Index, &b.Blob, &b.KZGCommitment, &b.KZGProof,
+		&b.SignedBlockHeader, &b.KZGCommitmentInclusionProof)
+}
+
+func (b *BlobSidecar) Serialize(w *codec.EncodingWriter) error {
+	return w.FixedLenContainer(&b.Index, &b.Blob, &b.KZGCommitment, &b.KZGProof,
+		&b.SignedBlockHeader, &b.KZGCommitmentInclusionProof)
+}
+
+// index, blob, commitment, proof, signed block header, inclusion proof
+const blobSidecarByteLen = 8 + BYTES_PER_BLOB + KZGCommitmentSize + KZGProofSize + (112 + 96) + KZG_COMMITMENT_INCLUSION_PROOF_DEPTH*32
+
+func (b *BlobSidecar) ByteLength() uint64 {
+	return blobSidecarByteLen
+}
+
+func (*BlobSidecar) FixedLength() uint64 {
+	return blobSidecarByteLen
+}
+
+func (b *BlobSidecar) String() string {
+	return fmt.Sprintf("BlobSidecar(index: %d, slot: %d, commitment: %s)",
+		b.Index, b.SignedBlockHeader.Message.Slot, b.KZGCommitment)
+}
+
+// BlobSidecarMinMax is the size range of an encoded BlobSidecar.
+var BlobSidecarMinMax = reqresp.MinMaxSize{Min: blobSidecarByteLen, Max: blobSidecarByteLen}
@@ -1,8 +1,11 @@
 package methods
 
 import (
+	"context"
 	"encoding/hex"
 	"fmt"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/protolambda/go-eth2-reqresp/reqresp"
 	"github.com/protolambda/zrnt/eth2/beacon/common"
 	"github.com/protolambda/zrnt/eth2/beacon/phase0"
@@ -39,30 +42,46 @@ func (d *BlocksByRangeReqV1) HashTreeRoot(hFn tree.HashFn) common.Root {
 	return hFn.HashTreeRoot(&d.StartSlot, &d.Count, &d.Step)
 }
 
+// MaxResponseChunks is the maximum number of blocks a peer may respond with while the given fork is active.
+func (d *BlocksByRangeReqV1) MaxResponseChunks(cfg *NetworkConfig, fork Fork) uint64 {
+	return minUint64(uint64(d.Count), cfg.MaxRequestBlocks(fork))
+}
+
 func (r *BlocksByRangeReqV1) String() string {
 	return fmt.Sprintf("%v", *r)
 }
 
-func BlocksByRangeRPCv1(spec *common.Spec) *reqresp.Method {
+// BlocksByRangeRPCv1 serves phase0 blocks, with the pre-deneb request limit.
+func BlocksByRangeRPCv1(spec *common.Spec, cfg *NetworkConfig) *reqresp.Method {
 	typ := phase0.SignedBeaconBlockType(spec)
-	minMax := reqresp.MinMaxSize{Min: typ.MinByteLength(), Max: typ.MaxByteLength()}
+	minMax := cfg.payloadMinMax(reqresp.MinMaxSize{Min: typ.MinByteLength(), Max: typ.MaxByteLength()})
 	return &reqresp.Method{
-		Protocol:         "/eth2/beacon_chain/req/beacon_blocks_by_range/1/ssz_snappy",
+		Protocol:         reqresp.BeaconChainProtocol("beacon_blocks_by_range", 1, reqresp.SnappyCompression{}),
 		RequestMinMax:    reqresp.MinMaxSize{Min: blocksByRangeReqByteLen, Max: blocksByRangeReqByteLen},
 		Compression:      reqresp.SnappyCompression{},
+		MaxPayloadSize:   cfg.MAX_PAYLOAD_SIZE,
 		ReadContextBytes: NoContext(minMax),
+		MaxResponseChunks: maxChunksOf(func(req *BlocksByRangeReqV1) uint64 {
+			return req.MaxResponseChunks(cfg, ForkPhase0)
+		}),
 	}
 }
 
-func BlocksByRangeRPCv2(spec *common.Spec, blocksMinMax map[common.ForkDigest]reqresp.MinMaxSize) *reqresp.Method {
+// BlocksByRangeRPCv2 serves blocks with the request limit of the given current fork.
+func BlocksByRangeRPCv2(spec *common.Spec, cfg *NetworkConfig, fork Fork, blocksMinMax map[common.ForkDigest]reqresp.MinMaxSize) *reqresp.Method {
 	return &reqresp.Method{
-		Protocol:         "/eth2/beacon_chain/req/beacon_blocks_by_range/2/ssz_snappy",
+		Protocol:         reqresp.BeaconChainProtocol("beacon_blocks_by_range", 2, reqresp.SnappyCompression{}),
 		RequestMinMax:    reqresp.MinMaxSize{Min: blocksByRangeReqByteLen, Max: blocksByRangeReqByteLen},
 		Compression:      reqresp.SnappyCompression{},
-		ReadContextBytes: BlocksContext(blocksMinMax),
+		MaxPayloadSize:   cfg.MAX_PAYLOAD_SIZE,
+		ReadContextBytes: BlocksContext(cfg.payloadMinMaxPerDigest(blocksMinMax)),
+		MaxResponseChunks: maxChunksOf(func(req *BlocksByRangeReqV1) uint64 {
+			return req.MaxResponseChunks(cfg, fork)
+		}),
 	}
 }
 
+// MAX_REQUEST_BLOCKS_BY_ROOT is the list limit of BlocksByRootReqV1, the MAX_REQUEST_BLOCKS of all public networks.
 const MAX_REQUEST_BLOCKS_BY_ROOT = 1024
 
 type BlocksByRootReqV1 []common.Root
@@ -71,6 +90,38 @@ func (a *BlocksByRootReqV1) Deserialize(dr *codec.DecodingReader) error {
 	return tree.ReadRootsLimited(dr, (*[]common.Root)(a), MAX_REQUEST_BLOCKS_BY_ROOT)
 }
 
+// Limited decodes the request with the given list limit instead, such as the MaxRequestBlocks of the network.
+func (a *BlocksByRootReqV1) Limited(limit uint64) codec.Deserializable {
+	return &limitedRoots{req: a, roots: (*[]common.Root)(a), limit: limit}
+}
+
+// limitedRoots is the limitedReq of requests that are a list of roots.
+type limitedRoots struct {
+	req   codec.Serializable
+	roots *[]common.Root
+	limit uint64
+}
+
+func (l *limitedRoots) Deserialize(dr *codec.DecodingReader) error {
+	return tree.ReadRootsLimited(dr, l.roots, l.limit)
+}
+
+func (l *limitedRoots) Serialize(w *codec.EncodingWriter) error {
+	return l.req.Serialize(w)
+}
+
+func (l *limitedRoots) ByteLength() uint64 {
+	return l.req.ByteLength()
+}
+
+func (*limitedRoots) FixedLength() uint64 {
+	return 0
+}
+
+func (l *limitedRoots) request() codec.Serializable {
+	return l.req
+}
+
 func (a BlocksByRootReqV1) Serialize(w *codec.EncodingWriter) error {
 	return tree.WriteRoots(w, a)
 }
@@ -83,6 +134,12 @@ func (a *BlocksByRootReqV1) FixedLength() uint64 {
 	return 0 // it's a list, no fixed length
 }
 
+// MaxResponseChunks is the maximum number of blocks a peer may respond with while the given fork is active:
+// one per requested root.
+func (a BlocksByRootReqV1) MaxResponseChunks(cfg *NetworkConfig, fork Fork) uint64 {
+	return minUint64(uint64(len(a)), cfg.MaxRequestBlocks(fork))
+}
+
 func (r BlocksByRootReqV1) Data() []string {
 	out := make([]string, len(r), len(r))
 	for i := range r {
@@ -104,22 +161,232 @@ func (r BlocksByRootReqV1) String() string {
 	return "blocks-by-root requested: " + string(out[:len(out)-1])
 }
 
-func BlocksByRootRPCv1(spec *common.Spec) *reqresp.Method {
+// BlocksByRootRPCv1 serves phase0 blocks, with the pre-deneb request limit.
+func BlocksByRootRPCv1(spec *common.Spec, cfg *NetworkConfig) *reqresp.Method {
 	typ := phase0.SignedBeaconBlockType(spec)
-	minMax := reqresp.MinMaxSize{Min: typ.MinByteLength(), Max: typ.MaxByteLength()}
+	minMax := cfg.payloadMinMax(reqresp.MinMaxSize{Min: typ.MinByteLength(), Max: typ.MaxByteLength()})
 	return &reqresp.Method{
-		Protocol:         "/eth2/beacon_chain/req/beacon_blocks_by_root/1/ssz_snappy",
-		RequestMinMax:    reqresp.MinMaxSize{0, 32 * MAX_REQUEST_BLOCKS_BY_ROOT},
+		Protocol:         reqresp.BeaconChainProtocol("beacon_blocks_by_root", 1, reqresp.SnappyCompression{}),
+		RequestMinMax:    reqresp.MinMaxSize{Min: 0, Max: 32 * cfg.MaxRequestBlocks(ForkPhase0)},
 		Compression:      reqresp.SnappyCompression{},
+		MaxPayloadSize:   cfg.MAX_PAYLOAD_SIZE,
 		ReadContextBytes: NoContext(minMax),
+		MaxResponseChunks: maxChunksOf(func(req *BlocksByRootReqV1) uint64 {
+			return req.MaxResponseChunks(cfg, ForkPhase0)
+		}),
 	}
 }
 
-func BlocksByRootRPCv2(spec *common.Spec, blocksMinMax map[common.ForkDigest]reqresp.MinMaxSize) *reqresp.Method {
+// BlocksByRootRPCv2 serves blocks with the request limit of the given current fork.
+func BlocksByRootRPCv2(spec *common.Spec, cfg *NetworkConfig, fork Fork, blocksMinMax map[common.ForkDigest]reqresp.MinMaxSize) *reqresp.Method {
 	return &reqresp.Method{
-		Protocol:         "/eth2/beacon_chain/req/beacon_blocks_by_root/2/ssz_snappy",
-		RequestMinMax:    reqresp.MinMaxSize{0, 32 * MAX_REQUEST_BLOCKS_BY_ROOT},
+		Protocol:         reqresp.BeaconChainProtocol("beacon_blocks_by_root", 2, reqresp.SnappyCompression{}),
+		RequestMinMax:    reqresp.MinMaxSize{Min: 0, Max: 32 * cfg.MaxRequestBlocks(fork)},
 		Compression:      reqresp.SnappyCompression{},
-		ReadContextBytes: BlocksContext(blocksMinMax),
+		MaxPayloadSize:   cfg.MAX_PAYLOAD_SIZE,
+		ReadContextBytes: BlocksContext(cfg.payloadMinMaxPerDigest(blocksMinMax)),
+		MaxResponseChunks: maxChunksOf(func(req *BlocksByRootReqV1) uint64 {
+			return req.MaxResponseChunks(cfg, fork)
+		}),
+	}
+}
+
+// BlocksByRangeGroup prefers BlocksByRangeRPCv2, and falls back to BlocksByRangeRPCv1 for peers without v2.
+func BlocksByRangeGroup(spec *common.Spec, cfg *NetworkConfig, fork Fork, blocksMinMax map[common.ForkDigest]reqresp.MinMaxSize) reqresp.MethodGroup {
+	return reqresp.MethodGroup{BlocksByRangeRPCv2(spec, cfg, fork, blocksMinMax), BlocksByRangeRPCv1(spec, cfg)}
+}
+
+// BlocksByRootGroup prefers BlocksByRootRPCv2, and falls back to BlocksByRootRPCv1 for peers without v2.
+func BlocksByRootGroup(spec *common.Spec, cfg *NetworkConfig, fork Fork, blocksMinMax map[common.ForkDigest]reqresp.MinMaxSize) reqresp.MethodGroup {
+	return reqresp.MethodGroup{BlocksByRootRPCv2(spec, cfg, fork, blocksMinMax), BlocksByRootRPCv1(spec, cfg)}
+}
+
+// RequestBlocksByRange requests blocks from the peer with BlocksByRangeRPCv2, or v1 if the peer does not support v2,
+// and decodes each with the block type of the fork matching the context-bytes, or as phase0 block with v1.
+// The request limit is that of the given current fork.
+// The blocks received before any error are returned, along with the error.
+func RequestBlocksByRange(ctx context.Context, cfg *NetworkConfig, forks *ForkDigests, fork Fork,
+	newStreamFn reqresp.NewStreamFn, peerId peer.ID, req *BlocksByRangeReqV1) ([]common.SpecObj, error) {
+
+	return requestBlocks(ctx, BlocksByRangeGroup(forks.Spec, cfg, fork, forks.BlocksMinMax()), forks, newStreamFn, peerId, req)
+}
+
+// RequestBlocksByRoot requests blocks from the peer with BlocksByRootRPCv2, or v1 if the peer does not support v2,
+// and decodes each with the block type of the fork matching the context-bytes, or as phase0 block with v1.
+// The request limit is that of the given current fork.
+// The blocks received before any error are returned, along with the error.
+func RequestBlocksByRoot(ctx context.Context, cfg *NetworkConfig, forks *ForkDigests, fork Fork,
+	newStreamFn reqresp.NewStreamFn, peerId peer.ID, req BlocksByRootReqV1) ([]common.SpecObj, error) {
+
+	return requestBlocks(ctx, BlocksByRootGroup(forks.Spec, cfg, fork, forks.BlocksMinMax()), forks, newStreamFn, peerId, &req)
+}
+
+// requestBlocks runs a request with the v2 and v1 versions of a blocks method.
+func requestBlocks(ctx context.Context, group reqresp.MethodGroup, forks *ForkDigests,
+	newStreamFn reqresp.NewStreamFn, peerId peer.ID, req codec.Serializable) ([]common.SpecObj, error) {
+
+	v2 := group[0]
+	var blocks []common.SpecObj
+	_, err := group.RunRequest(ctx, newStreamFn, peerId, req, reqresp.MethodResponseChunks, func(m *reqresp.Method, chunk reqresp.ChunkedResponseHandler) error {
+		if chunk.ResultCode() != reqresp.SuccessCode {
+			return chunk.ReadErr()
+		}
+		var block common.SpecObj
+		readBlock := forks.ReadBlock(&block)
+		if m != v2 {
+			// v1 has no context-bytes, and only phase0 blocks.
+			readBlock = func(contextBytes []byte) (codec.Deserializable, error) {
+				block = new(phase0.SignedBeaconBlock)
+				return forks.Spec.Wrap(block), nil
+			}
+		}
+		if err := chunk.ReadObj(readBlock); err != nil {
+			return fmt.Errorf("failed to decode block %d: %v", chunk.ChunkIndex(), err)
+		}
+		blocks = append(blocks, block)
+		return nil
+	})
+	return blocks, err
+}
+
+type BlocksByRangeProvider interface {
+	// BlocksInRange returns the canonical blocks of the slots [start, start+count), skipping empty slots.
+	BlocksInRange(ctx context.Context, start common.Slot, count uint64) ([]common.SpecObj, error)
+}
+
+// BlocksByRangeStreamHandler builds the stream handler of blocks-by-range v2, served by ServeBlocksByRange.
+func BlocksByRangeStreamHandler(newCtx reqresp.StreamCtxFn, cfg *NetworkConfig, forks *ForkDigests, fork Fork,
+	provider BlocksByRangeProvider) network.StreamHandler {
+	method := BlocksByRangeRPCv2(forks.Spec, cfg, fork, forks.BlocksMinMax())
+	return method.MakeStreamHandler(newCtx, ServeBlocksByRange(cfg, forks, fork, provider))
+}
+
+// ServeBlocksByRange handles blocks-by-range v2 requests with the given provider,
+// with the fork digest of each block slot as context-bytes.
+// The count is capped by the request limit of the given current fork,
+// and a deprecated step larger than 1 is served with just the first block.
+// Blocks of the provider outside of the requested range, or not in ascending slot order, are not served.
+func ServeBlocksByRange(cfg *NetworkConfig, forks *ForkDigests, fork Fork, provider BlocksByRangeProvider) reqresp.OnRequestListener {
+	return func(ctx context.Context, peerId peer.ID, handler reqresp.ChunkedRequestHandler) {
+		var req BlocksByRangeReqV1
+		if err := handler.ReadRequest(&req); err != nil {
+			_ = handler.WriteErrorChunk(reqresp.InvalidReqCode, "could not parse blocks-by-range request")
+			return
+		}
+		if req.Step == 0 {
+			_ = handler.WriteErrorChunk(reqresp.InvalidReqCode, "step must be at least 1")
+			return
+		}
+		count := req.MaxResponseChunks(cfg, fork)
+		if req.Step > 1 {
+			count = minUint64(count, 1)
+		}
+		if count == 0 {
+			return
+		}
+		blocks, err := provider.BlocksInRange(ctx, req.StartSlot, count)
+		if err != nil {
+			_ = handler.WriteErrorChunk(reqresp.ServerErrCode, "failed to get blocks in range")
+			return
+		}
+		if uint64(len(blocks)) > count {
+			blocks = blocks[:count]
+		}
+		if err := checkBlocksInRange(forks, blocks, req.StartSlot, count); err != nil {
+			_ = handler.WriteErrorChunk(reqresp.ServerErrCode, "failed to get blocks in range")
+			return
+		}
+		streamBlocks(handler, forks, blocks)
+	}
+}
+
+// checkBlocksInRange checks that the blocks are in the slots [start, start+count), in ascending slot order.
+func checkBlocksInRange(forks *ForkDigests, blocks []common.SpecObj, start common.Slot, count uint64) error {
+	var prev common.Slot
+	for i, block := range blocks {
+		slot, err := forks.BlockSlot(block)
+		if err != nil {
+			return err
+		}
+		if slot < start || uint64(slot-start) >= count {
+			return fmt.Errorf("block %d slot %d is outside of range [%d, %d+%d)", i, slot, start, start, count)
+		}
+		if i > 0 && slot <= prev {
+			return fmt.Errorf("block %d slot %d is not after previous slot %d", i, slot, prev)
+		}
+		prev = slot
+	}
+	return nil
+}
+
+// streamBlocks writes the blocks as success chunks, and ends the response with a server error if one cannot be written.
+func streamBlocks(handler reqresp.ChunkedRequestHandler, forks *ForkDigests, blocks []common.SpecObj) {
+	for _, block := range blocks {
+		if err := forks.StreamBlock(handler, block); err != nil {
+			_ = handler.WriteErrorChunk(reqresp.ServerErrCode, "failed to serve block")
+			return
+		}
+	}
+}
+
+type BlocksByRootProvider interface {
+	// BlocksByRoot returns the available blocks of the given roots, in the same order, skipping unknown roots.
+	BlocksByRoot(ctx context.Context, roots []common.Root) ([]common.SpecObj, error)
+}
+
+// BlocksByRootStreamHandler builds the stream handler of blocks-by-root v2, served by ServeBlocksByRoot.
+func BlocksByRootStreamHandler(newCtx reqresp.StreamCtxFn, cfg *NetworkConfig, forks *ForkDigests, fork Fork,
+	provider BlocksByRootProvider) network.StreamHandler {
+	method := BlocksByRootRPCv2(forks.Spec, cfg, fork, forks.BlocksMinMax())
+	return method.MakeStreamHandler(newCtx, ServeBlocksByRoot(cfg, forks, fork, provider))
+}
+
+// ServeBlocksByRoot handles blocks-by-root v2 requests with the given provider,
+// with the fork digest of each block slot as context-bytes.
+// Requests with more roots than the request limit of the given current fork are invalid.
+// Blocks of the provider that were not requested, or not in the order of the request, are not served.
+func ServeBlocksByRoot(cfg *NetworkConfig, forks *ForkDigests, fork Fork, provider BlocksByRootProvider) reqresp.OnRequestListener {
+	return func(ctx context.Context, peerId peer.ID, handler reqresp.ChunkedRequestHandler) {
+		var req BlocksByRootReqV1
+		if err := handler.ReadRequest(req.Limited(cfg.MaxRequestBlocks(fork))); err != nil {
+			_ = handler.WriteErrorChunk(reqresp.InvalidReqCode, "could not parse blocks-by-root request")
+			return
+		}
+		count := req.MaxResponseChunks(cfg, fork)
+		if count == 0 {
+			return
+		}
+		blocks, err := provider.BlocksByRoot(ctx, req[:count])
+		if err != nil {
+			_ = handler.WriteErrorChunk(reqresp.ServerErrCode, "failed to get blocks by root")
+			return
+		}
+		if uint64(len(blocks)) > count {
+			blocks = blocks[:count]
+		}
+		if err := checkBlocksByRoot(forks, blocks, req[:count]); err != nil {
+			_ = handler.WriteErrorChunk(reqresp.ServerErrCode, "failed to get blocks by root")
+			return
+		}
+		streamBlocks(handler, forks, blocks)
+	}
+}
+
+// checkBlocksByRoot checks that the blocks have roots of the request, in the order of the request.
+func checkBlocksByRoot(forks *ForkDigests, blocks []common.SpecObj, roots []common.Root) error {
+	i := 0
+	for j, block := range blocks {
+		root, err := forks.BlockRoot(block)
+		if err != nil {
+			return err
+		}
+		for i < len(roots) && roots[i] != root {
+			i++
+		}
+		if i == len(roots) {
+			return fmt.Errorf("block %d root %s was not requested, or is out of order", j, root)
+		}
+		i++
 	}
+	return nil
 }
@@ -1,8 +1,9 @@
 package methods
 
 import (
-	"bytes"
 	"context"
+	"errors"
+	"github.com/libp2p/go-libp2p-core/host"
 	"github.com/libp2p/go-libp2p-core/peer"
 	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
 	"github.com/protolambda/go-eth2-reqresp/reqresp"
@@ -19,6 +20,14 @@ import (
 var phase0Digest = common.ForkDigest{0xaa}
 var altairDigest = common.ForkDigest{0xbb}
 
+// testBlockForks registers the test digests, instead of digests computed from a fork schedule.
+func testBlockForks(spec *common.Spec) *ForkDigests {
+	return &ForkDigests{Spec: spec, Forks: []DigestedFork{
+		{ScheduledFork: ScheduledFork{Fork: ForkPhase0}, Digest: phase0Digest},
+		{ScheduledFork: ScheduledFork{Fork: ForkAltair}, Digest: altairDigest},
+	}}
+}
+
 func TestBlocksByRangeRPCv2(t *testing.T) {
 
 	spec := configs.Mainnet
@@ -57,12 +66,8 @@ func TestBlocksByRangeRPCv2(t *testing.T) {
 }
 
 func blocksByRangeExchange(t *testing.T, mock *mock.Mock, spec *common.Spec, realReq *BlocksByRangeReqV1) {
-	phase0Typ := phase0.SignedBeaconBlockType(spec)
-	altairTyp := altair.SignedBeaconBlockType(spec)
-	method := BlocksByRangeRPCv2(spec, map[common.ForkDigest]reqresp.MinMaxSize{
-		phase0Digest: {Min: phase0Typ.MinByteLength(), Max: altairTyp.MaxByteLength()},
-		altairDigest: {Min: altairTyp.MinByteLength(), Max: altairTyp.MaxByteLength()},
-	})
+	forks := testBlockForks(spec)
+	method := BlocksByRangeRPCv2(spec, MainnetNetworkConfig(), ForkAltair, forks.BlocksMinMax())
 
 	assert := assert.New(t)
 
@@ -93,19 +98,10 @@ func blocksByRangeExchange(t *testing.T, mock *mock.Mock, spec *common.Spec, rea
 	})
 	peerA.SetStreamHandler(method.Protocol, h)
 
-	err = method.RunRequest(context.Background(), peerB.NewStream, peerA.ID(), realReq, 3, func(chunk reqresp.ChunkedResponseHandler) error {
+	err = method.RunRequest(context.Background(), peerB.NewStream, peerA.ID(), realReq, reqresp.MethodResponseChunks, func(chunk reqresp.ChunkedResponseHandler) error {
 		for i := uint64(0); i < uint64(realReq.Count); i++ {
 			var block common.SpecObj
-			err := chunk.ReadObj(func(contextBytes []byte) (dest codec.Deserializable, err error) {
-				if bytes.Compare(contextBytes, phase0Digest[:]) == 0 {
-					block = new(phase0.SignedBeaconBlock)
-				} else if bytes.Compare(contextBytes, altairDigest[:]) == 0 {
-					block = new(altair.SignedBeaconBlock)
-				} else {
-					mock.MethodCalled("bad", "unknown context bytes", contextBytes)
-				}
-				return spec.Wrap(block), nil
-			})
+			err := chunk.ReadObj(forks.ReadBlock(&block))
 			if err != nil {
 				mock.MethodCalled("readFail", err)
 				return err
@@ -120,3 +116,346 @@ func blocksByRangeExchange(t *testing.T, mock *mock.Mock, spec *common.Spec, rea
 
 	mock.AssertExpectations(t)
 }
+
+func TestBlocksByRangeMaxResponseChunks(t *testing.T) {
+	assert := assert.New(t)
+	spec := configs.Mainnet
+	method := BlocksByRangeRPCv1(spec, MainnetNetworkConfig())
+
+	server, client := testPeers(t)
+	served := make(chan []error, 1)
+	server.SetStreamHandler(method.Protocol, method.MakeStreamHandler(context.Background,
+		func(ctx context.Context, peerId peer.ID, handler reqresp.ChunkedRequestHandler) {
+			var req BlocksByRangeReqV1
+			if err := handler.ReadRequest(&req); err != nil {
+				_ = handler.WriteErrorChunk(reqresp.InvalidReqCode, "bad input")
+				return
+			}
+			// try to respond with more blocks than requested
+			var errs []error
+			for i := uint64(0); i < uint64(req.Count)+1; i++ {
+				block := &phase0.SignedBeaconBlock{Message: phase0.BeaconBlock{Slot: req.StartSlot + common.Slot(i)}}
+				errs = append(errs, handler.StreamSSZ(reqresp.SuccessCode, nil, spec.Wrap(block)))
+			}
+			served <- errs
+		}))
+
+	req := &BlocksByRangeReqV1{StartSlot: 10, Count: 2, Step: 1}
+	var got []common.Slot
+	err := method.RunRequest(context.Background(), client.NewStream, server.ID(), req, reqresp.MethodResponseChunks,
+		func(chunk reqresp.ChunkedResponseHandler) error {
+			var block phase0.SignedBeaconBlock
+			if err := chunk.ReadObj(func(contextBytes []byte) (codec.Deserializable, error) {
+				return spec.Wrap(&block), nil
+			}); err != nil {
+				return err
+			}
+			got = append(got, block.Message.Slot)
+			return nil
+		})
+	assert.NoError(err)
+	assert.Equal([]common.Slot{10, 11}, got)
+
+	errs := <-served
+	if assert.Len(errs, 3) {
+		assert.NoError(errs[0])
+		assert.NoError(errs[1])
+		assert.Error(errs[2], "the request allows only 2 chunks")
+	}
+}
+
+func TestRequestBlocks(t *testing.T) {
+	assert := assert.New(t)
+	spec := configs.Mainnet
+	forks := testBlockForks(spec)
+	cfg := MainnetNetworkConfig()
+
+	server, client := testPeers(t)
+	bgCtx := func() context.Context {
+		return context.Background()
+	}
+	// serves phase0 blocks, up to slot 15
+	byRange := BlocksByRangeRPCv2(spec, cfg, ForkAltair, forks.BlocksMinMax())
+	server.SetStreamHandler(byRange.Protocol, byRange.MakeStreamHandler(bgCtx,
+		func(ctx context.Context, peerId peer.ID, handler reqresp.ChunkedRequestHandler) {
+			var req BlocksByRangeReqV1
+			if err := handler.ReadRequest(&req); err != nil {
+				_ = handler.WriteErrorChunk(reqresp.InvalidReqCode, "bad input")
+				return
+			}
+			for i := uint64(0); i < uint64(req.Count); i++ {
+				slot := req.StartSlot + common.Slot(i)
+				if slot > 15 {
+					_ = handler.WriteErrorChunk(reqresp.ServerErrCode, "failed to load block")
+					return
+				}
+				block := &phase0.SignedBeaconBlock{Message: phase0.BeaconBlock{Slot: slot}}
+				assert.NoError(handler.StreamSSZ(reqresp.SuccessCode, phase0Digest[:], spec.Wrap(block)))
+			}
+		}))
+	// serves a phase0 block per root, with the first root byte as slot
+	byRoot := BlocksByRootRPCv2(spec, cfg, ForkAltair, forks.BlocksMinMax())
+	server.SetStreamHandler(byRoot.Protocol, byRoot.MakeStreamHandler(bgCtx,
+		func(ctx context.Context, peerId peer.ID, handler reqresp.ChunkedRequestHandler) {
+			var req BlocksByRootReqV1
+			if err := handler.ReadRequest(&req); err != nil {
+				_ = handler.WriteErrorChunk(reqresp.InvalidReqCode, "bad input")
+				return
+			}
+			for _, root := range req {
+				block := &phase0.SignedBeaconBlock{Message: phase0.BeaconBlock{Slot: common.Slot(root[0])}}
+				assert.NoError(handler.StreamSSZ(reqresp.SuccessCode, phase0Digest[:], spec.Wrap(block)))
+			}
+		}))
+
+	slots := func(blocks []common.SpecObj) (out []common.Slot) {
+		for _, b := range blocks {
+			out = append(out, b.(*phase0.SignedBeaconBlock).Message.Slot)
+		}
+		return
+	}
+
+	ctx := context.Background()
+	t.Run("by range", func(t *testing.T) {
+		blocks, err := RequestBlocksByRange(ctx, cfg, forks, ForkAltair, client.NewStream, server.ID(),
+			&BlocksByRangeReqV1{StartSlot: 10, Count: 3, Step: 1})
+		assert.NoError(err)
+		assert.Equal([]common.Slot{10, 11, 12}, slots(blocks))
+	})
+	t.Run("by range partial", func(t *testing.T) {
+		blocks, err := RequestBlocksByRange(ctx, cfg, forks, ForkAltair, client.NewStream, server.ID(),
+			&BlocksByRangeReqV1{StartSlot: 13, Count: 5, Step: 1})
+		assert.Equal(&reqresp.ErrorResponse{Code: reqresp.ServerErrCode, Msg: "failed to load block"}, err)
+		assert.Equal([]common.Slot{13, 14, 15}, slots(blocks))
+	})
+	t.Run("by root", func(t *testing.T) {
+		blocks, err := RequestBlocksByRoot(ctx, cfg, forks, ForkAltair, client.NewStream, server.ID(),
+			BlocksByRootReqV1{{3}, {1}, {2}})
+		assert.NoError(err)
+		assert.Equal([]common.Slot{3, 1, 2}, slots(blocks))
+	})
+}
+
+type testBlocksProvider struct {
+	blocks map[common.Slot]common.SpecObj
+	err    error
+	// sloppy providers include the block before the range, reverse providers return the blocks in descending order.
+	sloppy  bool
+	reverse bool
+	// slotRoots providers look up blocks by the first byte of the root as slot, instead of the block root.
+	slotRoots bool
+}
+
+func (p *testBlocksProvider) BlocksInRange(ctx context.Context, start common.Slot, count uint64) (out []common.SpecObj, err error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	if p.sloppy {
+		start--
+	}
+	for slot := start; slot < start+common.Slot(count); slot++ {
+		if b, ok := p.blocks[slot]; ok {
+			if p.reverse {
+				out = append([]common.SpecObj{b}, out...)
+			} else {
+				out = append(out, b)
+			}
+		}
+	}
+	return out, nil
+}
+
+// BlocksByRoot returns the blocks of the given roots, as mainnet blocks.
+func (p *testBlocksProvider) BlocksByRoot(ctx context.Context, roots []common.Root) (out []common.SpecObj, err error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	for _, root := range roots {
+		var block common.SpecObj
+		if p.slotRoots {
+			block = p.blocks[common.Slot(root[0])]
+		} else {
+			for _, b := range p.blocks {
+				if blockRoot, err := (&ForkDigests{Spec: configs.Mainnet}).BlockRoot(b); err == nil && blockRoot == root {
+					block = b
+				}
+			}
+		}
+		if block == nil {
+			continue
+		}
+		if p.reverse {
+			out = append([]common.SpecObj{block}, out...)
+		} else {
+			out = append(out, block)
+		}
+	}
+	return out, nil
+}
+
+func TestServeBlocks(t *testing.T) {
+	assert := assert.New(t)
+	spec := configs.Mainnet
+	cfg := MainnetNetworkConfig()
+	forks := &ForkDigests{Spec: spec, Forks: []DigestedFork{
+		{ScheduledFork: ScheduledFork{Fork: ForkPhase0}, Digest: phase0Digest},
+		{ScheduledFork: ScheduledFork{Fork: ForkAltair, Epoch: 1}, Digest: altairDigest},
+	}}
+	body := altair.BeaconBlockBody{SyncAggregate: altair.SyncAggregate{
+		SyncCommitteeBits: make(altair.SyncCommitteeBits, spec.SYNC_COMMITTEE_SIZE/8)}}
+	provider := &testBlocksProvider{blocks: map[common.Slot]common.SpecObj{
+		30: &phase0.SignedBeaconBlock{Message: phase0.BeaconBlock{Slot: 30}},
+		32: &altair.SignedBeaconBlock{Message: altair.BeaconBlock{Slot: 32, Body: body}},
+		33: &altair.SignedBeaconBlock{Message: altair.BeaconBlock{Slot: 33, Body: body}},
+	}}
+
+	byRange := BlocksByRangeRPCv2(spec, cfg, ForkAltair, forks.BlocksMinMax())
+	byRoot := BlocksByRootRPCv2(spec, cfg, ForkAltair, forks.BlocksMinMax())
+	serve := func(provider *testBlocksProvider) (server host.Host, client host.Host) {
+		server, client = testPeers(t)
+		server.SetStreamHandler(byRange.Protocol, BlocksByRangeStreamHandler(context.Background, cfg, forks, ForkAltair, provider))
+		server.SetStreamHandler(byRoot.Protocol, BlocksByRootStreamHandler(context.Background, cfg, forks, ForkAltair, provider))
+		return server, client
+	}
+	server, client := serve(provider)
+	expectServerErr := func(t *testing.T, blocks []common.SpecObj, err error) {
+		var errResp *reqresp.ErrorResponse
+		if assert.ErrorAs(err, &errResp) {
+			assert.Equal(reqresp.ServerErrCode, errResp.Code)
+		}
+		assert.Empty(blocks)
+	}
+
+	ctx := context.Background()
+	t.Run("by range", func(t *testing.T) {
+		blocks, err := RequestBlocksByRange(ctx, cfg, forks, ForkAltair, client.NewStream, server.ID(),
+			&BlocksByRangeReqV1{StartSlot: 29, Count: 10, Step: 1})
+		assert.NoError(err)
+		assert.Equal([]common.SpecObj{provider.blocks[30], provider.blocks[32], provider.blocks[33]}, blocks)
+	})
+	t.Run("by range with step", func(t *testing.T) {
+		blocks, err := RequestBlocksByRange(ctx, cfg, forks, ForkAltair, client.NewStream, server.ID(),
+			&BlocksByRangeReqV1{StartSlot: 32, Count: 10, Step: 2})
+		assert.NoError(err)
+		assert.Equal([]common.SpecObj{provider.blocks[32]}, blocks)
+	})
+	t.Run("by range without step", func(t *testing.T) {
+		blocks, err := RequestBlocksByRange(ctx, cfg, forks, ForkAltair, client.NewStream, server.ID(),
+			&BlocksByRangeReqV1{StartSlot: 32, Count: 10, Step: 0})
+		assert.Empty(blocks)
+		var errResp *reqresp.ErrorResponse
+		if assert.ErrorAs(err, &errResp) {
+			assert.Equal(reqresp.InvalidReqCode, errResp.Code)
+		}
+	})
+	rootOf := func(slot common.Slot) common.Root {
+		root, err := forks.BlockRoot(provider.blocks[slot])
+		assert.NoError(err)
+		return root
+	}
+	t.Run("by root", func(t *testing.T) {
+		blocks, err := RequestBlocksByRoot(ctx, cfg, forks, ForkAltair, client.NewStream, server.ID(),
+			BlocksByRootReqV1{rootOf(33), {31}, rootOf(30)})
+		assert.NoError(err)
+		assert.Equal([]common.SpecObj{provider.blocks[33], provider.blocks[30]}, blocks)
+	})
+	t.Run("blocks not requested", func(t *testing.T) {
+		server, client := serve(&testBlocksProvider{blocks: provider.blocks, slotRoots: true})
+		blocks, err := RequestBlocksByRoot(ctx, cfg, forks, ForkAltair, client.NewStream, server.ID(),
+			BlocksByRootReqV1{{33}, {30}})
+		expectServerErr(t, blocks, err)
+
+		// blocks out of the order of the request are not served either
+		server, client = serve(&testBlocksProvider{blocks: provider.blocks, reverse: true})
+		blocks, err = RequestBlocksByRoot(ctx, cfg, forks, ForkAltair, client.NewStream, server.ID(),
+			BlocksByRootReqV1{rootOf(30), rootOf(33)})
+		expectServerErr(t, blocks, err)
+	})
+	t.Run("provider error", func(t *testing.T) {
+		server, client := serve(&testBlocksProvider{err: errors.New("internal details")})
+		blocks, err := RequestBlocksByRange(ctx, cfg, forks, ForkAltair, client.NewStream, server.ID(),
+			&BlocksByRangeReqV1{StartSlot: 29, Count: 10, Step: 1})
+		expectServerErr(t, blocks, err)
+		assert.NotContains(err.Error(), "internal details")
+	})
+	t.Run("blocks outside of range", func(t *testing.T) {
+		blocks, err := RequestBlocksByRange(ctx, cfg, forks, ForkAltair, client.NewStream, server.ID(),
+			&BlocksByRangeReqV1{StartSlot: 31, Count: 2, Step: 1})
+		assert.NoError(err)
+		assert.Equal([]common.SpecObj{provider.blocks[32]}, blocks)
+
+		server, client := serve(&testBlocksProvider{blocks: provider.blocks, sloppy: true})
+		blocks, err = RequestBlocksByRange(ctx, cfg, forks, ForkAltair, client.NewStream, server.ID(),
+			&BlocksByRangeReqV1{StartSlot: 31, Count: 2, Step: 1})
+		expectServerErr(t, blocks, err)
+	})
+	t.Run("blocks out of order", func(t *testing.T) {
+		server, client := serve(&testBlocksProvider{blocks: provider.blocks, reverse: true})
+		blocks, err := RequestBlocksByRange(ctx, cfg, forks, ForkAltair, client.NewStream, server.ID(),
+			&BlocksByRangeReqV1{StartSlot: 30, Count: 4, Step: 1})
+		expectServerErr(t, blocks, err)
+	})
+	t.Run("unknown block type", func(t *testing.T) {
+		server, client := serve(&testBlocksProvider{blocks: map[common.Slot]common.SpecObj{
+			30: provider.blocks[30],
+			31: new(unknownBlock),
+		}, slotRoots: true})
+		blocks, err := RequestBlocksByRoot(ctx, cfg, forks, ForkAltair, client.NewStream, server.ID(),
+			BlocksByRootReqV1{{30}, {31}})
+		expectServerErr(t, blocks, err)
+	})
+}
+
+// unknownBlock is a block type without a known slot, which cannot be served.
+type unknownBlock struct {
+	common.SpecObj
+}
+
+func TestRequestBlocksFallback(t *testing.T) {
+	assert := assert.New(t)
+	spec := configs.Mainnet
+	forks := testBlockForks(spec)
+	cfg := MainnetNetworkConfig()
+
+	// the server only supports v1
+	server, client := testPeers(t)
+	v1 := BlocksByRangeRPCv1(spec, cfg)
+	server.SetStreamHandler(v1.Protocol, v1.MakeStreamHandler(context.Background,
+		func(ctx context.Context, peerId peer.ID, handler reqresp.ChunkedRequestHandler) {
+			var req BlocksByRangeReqV1
+			if err := handler.ReadRequest(&req); err != nil {
+				_ = handler.WriteErrorChunk(reqresp.InvalidReqCode, "bad input")
+				return
+			}
+			for i := uint64(0); i < uint64(req.Count); i++ {
+				block := &phase0.SignedBeaconBlock{Message: phase0.BeaconBlock{Slot: req.StartSlot + common.Slot(i)}}
+				assert.NoError(handler.StreamSSZ(reqresp.SuccessCode, nil, spec.Wrap(block)))
+			}
+		}))
+
+	blocks, err := RequestBlocksByRange(context.Background(), cfg, forks, ForkAltair, client.NewStream, server.ID(),
+		&BlocksByRangeReqV1{StartSlot: 5, Count: 2, Step: 1})
+	assert.NoError(err)
+	assert.Equal([]common.SpecObj{
+		&phase0.SignedBeaconBlock{Message: phase0.BeaconBlock{Slot: 5}},
+		&phase0.SignedBeaconBlock{Message: phase0.BeaconBlock{Slot: 6}},
+	}, blocks)
+
+	// v2 is preferred if the server supports both
+	server, client = testPeers(t)
+	group := BlocksByRangeGroup(spec, cfg, ForkAltair, forks.BlocksMinMax())
+	for _, m := range group {
+		server.SetStreamHandler(m.Protocol, m.MakeStreamHandler(context.Background,
+			func(ctx context.Context, peerId peer.ID, handler reqresp.ChunkedRequestHandler) {
+				var req BlocksByRangeReqV1
+				_ = handler.ReadRequest(&req)
+			}))
+	}
+	m, err := group.RunRequest(context.Background(), client.NewStream, server.ID(),
+		&BlocksByRangeReqV1{StartSlot: 5, Count: 2, Step: 1}, reqresp.MethodResponseChunks,
+		func(m *reqresp.Method, chunk reqresp.ChunkedResponseHandler) error {
+			return nil
+		})
+	assert.NoError(err)
+	assert.Equal(group[0].Protocol, m.Protocol)
+}
@@ -1,31 +1,168 @@
 package methods
 
 import (
+	"context"
 	"fmt"
+	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/protolambda/go-eth2-reqresp/reqresp"
 	"github.com/protolambda/zrnt/eth2/beacon/common"
-	"io"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
 )
 
 func NoContext(minMaxSize reqresp.MinMaxSize) reqresp.ReadContextFn {
-	return func(blr *reqresp.BufLimitReader) (contextBytes []byte, minMax reqresp.MinMaxSize, err error) {
-		return nil, minMaxSize, nil
-	}
+	return reqresp.ReadContext(0, func(contextBytes []byte) (reqresp.ContextType, error) {
+		return reqresp.ContextType{MinMax: minMaxSize}, nil
+	})
 }
 
-func BlocksContext(blocksMinMax map[common.ForkDigest]reqresp.MinMaxSize) reqresp.ReadContextFn {
-	return func(blr *reqresp.BufLimitReader) (contextBytes []byte, minMax reqresp.MinMaxSize, err error) {
-		blr.N = 4
-		blr.PerRead = false
-		var digest common.ForkDigest
-		_, err = io.ReadFull(blr, digest[:])
+// ForkDigestLookup builds a context lookup for fork digests as <context-bytes>,
+// erroring with UnknownForkDigestError if the lookup does not know the digest.
+func ForkDigestLookup(lookup func(digest common.ForkDigest) (reqresp.ContextType, bool)) reqresp.ContextLookup {
+	return func(contextBytes []byte) (reqresp.ContextType, error) {
+		digest, err := toForkDigest(contextBytes)
 		if err != nil {
-			return nil, reqresp.MinMaxSize{}, err
+			return reqresp.ContextType{}, err
 		}
-		blockMinMax, ok := blocksMinMax[digest]
+		typ, ok := lookup(digest)
 		if !ok {
-			return nil, reqresp.MinMaxSize{}, fmt.Errorf("unknown fork-digest: %s", digest)
+			return reqresp.ContextType{}, &UnknownForkDigestError{ContextBytes: contextBytes}
 		}
-		return digest[:], blockMinMax, nil
+		return typ, nil
+	}
+}
+
+// ForkDigestContext reads a fork digest as <context-bytes>, and determines the chunk size range with the lookup.
+func ForkDigestContext(lookup func(digest common.ForkDigest) (reqresp.ContextType, bool)) reqresp.ReadContextFn {
+	return reqresp.ReadContext(4, ForkDigestLookup(lookup))
+}
+
+func BlocksContext(blocksMinMax map[common.ForkDigest]reqresp.MinMaxSize) reqresp.ReadContextFn {
+	return ForkDigestContext(func(digest common.ForkDigest) (reqresp.ContextType, bool) {
+		minMax, ok := blocksMinMax[digest]
+		return reqresp.ContextType{MinMax: minMax}, ok
+	})
+}
+
+// sszField is a container field that can be encoded, decoded and hashed.
+// Spec-dependent fields can be used after wrapping them with the spec.
+type sszField interface {
+	codec.Serializable
+	codec.Deserializable
+	tree.HTR
+}
+
+func deserializableFields(fields []sszField) []codec.Deserializable {
+	out := make([]codec.Deserializable, len(fields))
+	for i, f := range fields {
+		out[i] = f
+	}
+	return out
+}
+
+func serializableFields(fields []sszField) []codec.Serializable {
+	out := make([]codec.Serializable, len(fields))
+	for i, f := range fields {
+		out[i] = f
+	}
+	return out
+}
+
+func htrFields(fields []sszField) []tree.HTR {
+	out := make([]tree.HTR, len(fields))
+	for i, f := range fields {
+		out[i] = f
+	}
+	return out
+}
+
+// fixedContainerLength returns the size of a container with the given fields, or 0 if any field is variable size.
+func fixedContainerLength(fields []sszField) (out uint64) {
+	for _, f := range fields {
+		size := f.FixedLength()
+		if size == 0 {
+			return 0
+		}
+		out += size
+	}
+	return out
+}
+
+// EmptyReq is the request of methods without request data, e.g. MetaData. Nothing is written to the stream for it.
+type EmptyReq struct{}
+
+func (EmptyReq) Serialize(w *codec.EncodingWriter) error {
+	return nil
+}
+
+func (*EmptyReq) Deserialize(dr *codec.DecodingReader) error {
+	return nil
+}
+
+func (EmptyReq) ByteLength() uint64 {
+	return 0
+}
+
+func (EmptyReq) FixedLength() uint64 {
+	return 0
+}
+
+func (EmptyReq) String() string {
+	return "empty request"
+}
+
+// requestOne runs a request for a single response chunk, decoding it into the destination made for its context-bytes.
+// An error is returned if the peer responds with an error, or if it does not respond at all.
+func requestOne(ctx context.Context, m *reqresp.Method, newStreamFn reqresp.NewStreamFn, peerId peer.ID,
+	req codec.Serializable, makeDest func(contextBytes []byte) (codec.Deserializable, error)) error {
+
+	received := false
+	err := m.RunRequest(ctx, newStreamFn, peerId, req, 1, func(chunk reqresp.ChunkedResponseHandler) error {
+		if chunk.ResultCode() != reqresp.SuccessCode {
+			return chunk.ReadErr()
+		}
+		received = true
+		return chunk.ReadObj(makeDest)
+	})
+	if err != nil {
+		return err
+	}
+	if !received {
+		return fmt.Errorf("peer did not respond to %s", m.Protocol)
+	}
+	return nil
+}
+
+// limitedReq decodes a request with a list limit of the network config, such as BlocksByRootReqV1.Limited.
+// It encodes as the request it decodes into, and reading it arms the response chunk limit of that request.
+type limitedReq interface {
+	codec.Deserializable
+	codec.Serializable
+	// request returns the request that is decoded into.
+	request() codec.Serializable
+}
+
+// maxChunksOf builds the MaxResponseChunks of a method from that of its request type.
+// The request may be passed by value or by pointer, or as the limitedReq that decoded it.
+func maxChunksOf[T any](fn func(req *T) uint64) reqresp.MaxResponseChunksFn {
+	return func(req codec.Serializable) (uint64, error) {
+		if l, ok := req.(limitedReq); ok {
+			req = l.request()
+		}
+		switch r := interface{}(req).(type) {
+		case *T:
+			return fn(r), nil
+		case T:
+			return fn(&r), nil
+		default:
+			return 0, fmt.Errorf("unexpected request type %T", req)
+		}
+	}
+}
+
+// fixedDest returns a destination maker for methods without context-bytes.
+func fixedDest(dest codec.Deserializable) func(contextBytes []byte) (codec.Deserializable, error) {
+	return func(contextBytes []byte) (codec.Deserializable, error) {
+		return dest, nil
 	}
 }
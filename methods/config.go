@@ -0,0 +1,67 @@
+package methods
+
+import (
+	"github.com/protolambda/go-eth2-reqresp/reqresp"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+)
+
+// NetworkConfig is the req-resp part of the networking config.
+// These values are not part of the zrnt spec config, but are configured per network like it.
+// MAX_PAYLOAD_SIZE bounds the methods, and is enforced on all of their traffic.
+type NetworkConfig struct {
+	MAX_PAYLOAD_SIZE                  uint64 `yaml:"MAX_PAYLOAD_SIZE" json:"MAX_PAYLOAD_SIZE"`
+	MAX_REQUEST_BLOCKS                uint64 `yaml:"MAX_REQUEST_BLOCKS" json:"MAX_REQUEST_BLOCKS"`
+	MAX_REQUEST_BLOCKS_DENEB          uint64 `yaml:"MAX_REQUEST_BLOCKS_DENEB" json:"MAX_REQUEST_BLOCKS_DENEB"`
+	MAX_REQUEST_BLOB_SIDECARS         uint64 `yaml:"MAX_REQUEST_BLOB_SIDECARS" json:"MAX_REQUEST_BLOB_SIDECARS"`
+	MAX_REQUEST_BLOB_SIDECARS_ELECTRA uint64 `yaml:"MAX_REQUEST_BLOB_SIDECARS_ELECTRA" json:"MAX_REQUEST_BLOB_SIDECARS_ELECTRA"`
+	MAX_REQUEST_DATA_COLUMN_SIDECARS  uint64 `yaml:"MAX_REQUEST_DATA_COLUMN_SIDECARS" json:"MAX_REQUEST_DATA_COLUMN_SIDECARS"`
+	MAX_REQUEST_LIGHT_CLIENT_UPDATES  uint64 `yaml:"MAX_REQUEST_LIGHT_CLIENT_UPDATES" json:"MAX_REQUEST_LIGHT_CLIENT_UPDATES"`
+	MAX_REQUEST_PAYLOADS              uint64 `yaml:"MAX_REQUEST_PAYLOADS" json:"MAX_REQUEST_PAYLOADS"`
+}
+
+// MainnetNetworkConfig returns the networking config of mainnet, also used by the minimal config.
+// Every call returns a new copy, which can be modified freely.
+func MainnetNetworkConfig() *NetworkConfig {
+	return &NetworkConfig{
+		MAX_PAYLOAD_SIZE:                  10 * 1024 * 1024,
+		MAX_REQUEST_BLOCKS:                1024,
+		MAX_REQUEST_BLOCKS_DENEB:          128,
+		MAX_REQUEST_BLOB_SIDECARS:         128 * 6,
+		MAX_REQUEST_BLOB_SIDECARS_ELECTRA: 128 * MAX_BLOBS_PER_BLOCK_ELECTRA,
+		MAX_REQUEST_DATA_COLUMN_SIDECARS:  128 * NUMBER_OF_COLUMNS,
+		MAX_REQUEST_LIGHT_CLIENT_UPDATES:  128,
+		MAX_REQUEST_PAYLOADS:              MAX_REQUEST_PAYLOADS,
+	}
+}
+
+// MaxRequestBlocks is the maximum number of blocks per request while the given fork is active.
+func (cfg *NetworkConfig) MaxRequestBlocks(fork Fork) uint64 {
+	if fork >= ForkDeneb {
+		return cfg.MAX_REQUEST_BLOCKS_DENEB
+	}
+	return cfg.MAX_REQUEST_BLOCKS
+}
+
+// payloadMinMax limits the size range to the max payload size.
+func (cfg *NetworkConfig) payloadMinMax(minMax reqresp.MinMaxSize) reqresp.MinMaxSize {
+	if minMax.Max > cfg.MAX_PAYLOAD_SIZE {
+		minMax.Max = cfg.MAX_PAYLOAD_SIZE
+	}
+	return minMax
+}
+
+// payloadMinMaxPerDigest limits the size range of every fork digest to the max payload size.
+func (cfg *NetworkConfig) payloadMinMaxPerDigest(minMax map[common.ForkDigest]reqresp.MinMaxSize) map[common.ForkDigest]reqresp.MinMaxSize {
+	out := make(map[common.ForkDigest]reqresp.MinMaxSize, len(minMax))
+	for digest, mm := range minMax {
+		out[digest] = cfg.payloadMinMax(mm)
+	}
+	return out
+}
+
+func minUint64(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,84 @@
+package methods
+
+import (
+	"bytes"
+	"github.com/protolambda/go-eth2-reqresp/reqresp"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/configs"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNetworkConfigLimits(t *testing.T) {
+	assert := assert.New(t)
+	spec := configs.Mainnet
+	devnet := *MainnetNetworkConfig()
+	devnet.MAX_REQUEST_BLOCKS = 2048
+	devnet.MAX_PAYLOAD_SIZE = 1 << 16
+
+	req := make(BlocksByRootReqV1, 2000)
+	assert.Error(BlocksByRootRPCv1(spec, MainnetNetworkConfig()).RequestMinMax.Check(req.ByteLength()))
+	method := BlocksByRootRPCv1(spec, &devnet)
+	assert.NoError(method.RequestMinMax.Check(req.ByteLength()))
+	assert.Equal(devnet.MAX_PAYLOAD_SIZE, method.MaxPayloadSize)
+
+	var buf bytes.Buffer
+	assert.NoError(req.Serialize(codec.NewEncodingWriter(&buf)))
+	var got BlocksByRootReqV1
+	assert.Error(got.Deserialize(codec.NewDecodingReader(bytes.NewReader(buf.Bytes()), req.ByteLength())))
+	got = nil
+	limited := got.Limited(devnet.MAX_REQUEST_BLOCKS)
+	assert.NoError(limited.Deserialize(codec.NewDecodingReader(&buf, req.ByteLength())))
+	assert.Len(got, 2000)
+	// the limited request arms the response chunk limit of the request when it is read
+	if assert.Implements((*codec.Serializable)(nil), limited) {
+		n, err := method.MaxResponseChunks(limited.(codec.Serializable))
+		assert.NoError(err)
+		assert.Equal(uint64(2000), n)
+	}
+
+	// block chunks are limited to the max payload size
+	_, minMax, err := method.ReadContextBytes(reqresp.NewBufLimitReader(bytes.NewReader(nil), 1024, 0))
+	assert.NoError(err)
+	assert.Equal(devnet.MAX_PAYLOAD_SIZE, minMax.Max)
+
+	_, minMax, err = BlocksByRangeRPCv2(spec, &devnet, ForkAltair, map[common.ForkDigest]reqresp.MinMaxSize{
+		altairDigest: {Min: 100, Max: 1 << 30},
+	}).ReadContextBytes(reqresp.NewBufLimitReader(bytes.NewReader(altairDigest[:]), 1024, 0))
+	assert.NoError(err)
+	assert.Equal(reqresp.MinMaxSize{Min: 100, Max: devnet.MAX_PAYLOAD_SIZE}, minMax)
+
+	rangeReq := &BlocksByRangeReqV1{Count: 5000}
+	assert.Equal(uint64(2048), rangeReq.MaxResponseChunks(&devnet, ForkAltair))
+	assert.Equal(devnet.MAX_REQUEST_BLOCKS_DENEB, rangeReq.MaxResponseChunks(&devnet, ForkDeneb))
+	assert.Equal(32*devnet.MAX_REQUEST_BLOCKS_DENEB, BlocksByRootRPCv2(spec, &devnet, ForkDeneb, nil).RequestMinMax.Max)
+}
+
+func TestMethodsMaxPayloadSize(t *testing.T) {
+	spec := configs.Mainnet
+	cfg := MainnetNetworkConfig()
+	cfg.MAX_PAYLOAD_SIZE = 1 << 16
+	digests := []common.ForkDigest{altairDigest}
+	methods := []*reqresp.Method{
+		StatusRPCv1(cfg),
+		PingRPCv1(cfg),
+		GoodbyeRPCv1(cfg),
+		MetaDataRPCv1(cfg),
+		BlocksByRangeRPCv1(spec, cfg),
+		BlocksByRangeRPCv2(spec, cfg, ForkAltair, nil),
+		BlocksByRootRPCv1(spec, cfg),
+		BlocksByRootRPCv2(spec, cfg, ForkAltair, nil),
+		DataColumnSidecarsByRangeRPCv1(cfg, digests),
+		DataColumnSidecarsByRootRPCv1(cfg, digests),
+		ExecutionPayloadEnvelopesByRangeRPCv1(cfg, digests),
+		ExecutionPayloadEnvelopesByRootRPCv1(cfg, digests),
+		LightClientBootstrapRPCv1(spec, cfg, testLightClientForks),
+		LightClientUpdatesByRangeRPCv1(spec, cfg, testLightClientForks),
+		LightClientFinalityUpdateRPCv1(spec, cfg, testLightClientForks),
+		LightClientOptimisticUpdateRPCv1(spec, cfg, testLightClientForks),
+	}
+	for _, m := range methods {
+		assert.Equal(t, cfg.MAX_PAYLOAD_SIZE, m.MaxPayloadSize, "max payload size of %s", m.Protocol)
+	}
+}
@@ -0,0 +1,363 @@
+package methods
+
+import (
+	"fmt"
+	"github.com/protolambda/go-eth2-reqresp/reqresp"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
+	"github.com/protolambda/ztyp/view"
+	"strings"
+)
+
+// Fulu (PeerDAS) preset and networking values, mainnet.
+const (
+	NUMBER_OF_COLUMNS                     = 128
+	MAX_BLOB_COMMITMENTS_PER_BLOCK        = 4096
+	FIELD_ELEMENTS_PER_CELL               = 64
+	BYTES_PER_FIELD_ELEMENT               = 32
+	BYTES_PER_CELL                        = FIELD_ELEMENTS_PER_CELL * BYTES_PER_FIELD_ELEMENT
+	KZG_COMMITMENTS_INCLUSION_PROOF_DEPTH = 4
+)
+
+type Cell [BYTES_PER_CELL]byte
+
+func (c *Cell) Deserialize(dr *codec.DecodingReader) error {
+	_, err := dr.Read(c[:])
+	return err
+}
+
+func (c *Cell) Serialize(w *codec.EncodingWriter) error {
+	return w.Write(c[:])
+}
+
+func (Cell) ByteLength() uint64 {
+	return BYTES_PER_CELL
+}
+
+func (Cell) FixedLength() uint64 {
+	return BYTES_PER_CELL
+}
+
+type DataColumn []Cell
+
+func (li *DataColumn) Deserialize(dr *codec.DecodingReader) error {
+	return dr.List(func() codec.Deserializable {
+		i := len(*li)
+		*li = append(*li, Cell{})
+		return &(*li)[i]
+	}, BYTES_PER_CELL, MAX_BLOB_COMMITMENTS_PER_BLOCK)
+}
+
+func (li DataColumn) Serialize(w *codec.EncodingWriter) error {
+	return w.List(func(i uint64) codec.Serializable {
+		return &li[i]
+	}, BYTES_PER_CELL, uint64(len(li)))
+}
+
+func (li DataColumn) ByteLength() uint64 {
+	return uint64(len(li)) * BYTES_PER_CELL
+}
+
+func (*DataColumn) FixedLength() uint64 {
+	return 0
+}
+
+type KZGCommitmentsInclusionProof [KZG_COMMITMENTS_INCLUSION_PROOF_DEPTH]common.Root
+
+func (p *KZGCommitmentsInclusionProof) Deserialize(dr *codec.DecodingReader) error {
+	roots := p[:]
+	return tree.ReadRoots(dr, &roots, KZG_COMMITMENTS_INCLUSION_PROOF_DEPTH)
+}
+
+func (p *KZGCommitmentsInclusionProof) Serialize(w *codec.EncodingWriter) error {
+	return tree.WriteRoots(w, p[:])
+}
+
+func (KZGCommitmentsInclusionProof) ByteLength() uint64 {
+	return KZG_COMMITMENTS_INCLUSION_PROOF_DEPTH * 32
+}
+
+func (KZGCommitmentsInclusionProof) FixedLength() uint64 {
+	return KZG_COMMITMENTS_INCLUSION_PROOF_DEPTH * 32
+}
+
+// DataColumnSidecar is the fulu data column sidecar, as served by the data-column req-resp methods.
+type DataColumnSidecar struct {
+	Index                        view.Uint64View
+	Column                       DataColumn
+	KZGCommitments               KZGCommitments
+	KZGProofs                    KZGProofs
+	SignedBlockHeader            common.SignedBeaconBlockHeader
+	KZGCommitmentsInclusionProof KZGCommitmentsInclusionProof
+}
+
+func (d *DataColumnSidecar) Deserialize(dr *codec.DecodingReader) error {
+	return dr.Container(&d.Index, &d.Column, &d.KZGCommitments, &d.KZGProofs,
+		&d.SignedBlockHeader, &d.KZGCommitmentsInclusionProof)
+}
+
+func (d *DataColumnSidecar) Serialize(w *codec.EncodingWriter) error {
+	return w.Container(&d.Index, &d.Column, &d.KZGCommitments, &d.KZGProofs,
+		&d.SignedBlockHeader, &d.KZGCommitmentsInclusionProof)
+}
+
+func (d *DataColumnSidecar) ByteLength() uint64 {
+	return codec.ContainerLength(&d.Index, &d.Column, &d.KZGCommitments, &d.KZGProofs,
+		&d.SignedBlockHeader, &d.KZGCommitmentsInclusionProof)
+}
+
+func (*DataColumnSidecar) FixedLength() uint64 {
+	return 0
+}
+
+func (d *DataColumnSidecar) String() string {
+	return fmt.Sprintf("DataColumnSidecar(index: %d, slot: %d, cells: %d)",
+		d.Index, d.SignedBlockHeader.Message.Slot, len(d.Column))
+}
+
+// index, three list offsets, signed block header, inclusion proof
+const dataColumnSidecarMinByteLen = 8 + 4 + 4 + 4 + (112 + 96) + KZG_COMMITMENTS_INCLUSION_PROOF_DEPTH*32
+
+// DataColumnSidecarMinMax is the size range of an encoded DataColumnSidecar.
+var DataColumnSidecarMinMax = reqresp.MinMaxSize{
+	Min: dataColumnSidecarMinByteLen,
+	Max: dataColumnSidecarMinByteLen + MAX_BLOB_COMMITMENTS_PER_BLOCK*(BYTES_PER_CELL+KZGCommitmentSize+KZGProofSize),
+}
+
+type ColumnIndices []view.Uint64View
+
+func (li *ColumnIndices) Deserialize(dr *codec.DecodingReader) error {
+	return dr.List(func() codec.Deserializable {
+		i := len(*li)
+		*li = append(*li, 0)
+		return &(*li)[i]
+	}, 8, NUMBER_OF_COLUMNS)
+}
+
+func (li ColumnIndices) Serialize(w *codec.EncodingWriter) error {
+	return w.List(func(i uint64) codec.Serializable {
+		return li[i]
+	}, 8, uint64(len(li)))
+}
+
+func (li ColumnIndices) ByteLength() uint64 {
+	return uint64(len(li)) * 8
+}
+
+func (*ColumnIndices) FixedLength() uint64 {
+	return 0
+}
+
+func (li ColumnIndices) HashTreeRoot(hFn tree.HashFn) common.Root {
+	return hFn.Uint64ListHTR(func(i uint64) uint64 {
+		return uint64(li[i])
+	}, uint64(len(li)), NUMBER_OF_COLUMNS)
+}
+
+type DataColumnSidecarsByRangeReqV1 struct {
+	StartSlot common.Slot
+	Count     view.Uint64View
+	Columns   ColumnIndices
+}
+
+func (d *DataColumnSidecarsByRangeReqV1) Deserialize(dr *codec.DecodingReader) error {
+	return dr.Container(&d.StartSlot, &d.Count, &d.Columns)
+}
+
+func (d *DataColumnSidecarsByRangeReqV1) Serialize(w *codec.EncodingWriter) error {
+	return w.Container(&d.StartSlot, &d.Count, &d.Columns)
+}
+
+// start slot, count, columns offset
+const dataColumnsByRangeReqMinByteLen = 8 + 8 + 4
+
+func (d *DataColumnSidecarsByRangeReqV1) ByteLength() uint64 {
+	return dataColumnsByRangeReqMinByteLen + d.Columns.ByteLength()
+}
+
+func (*DataColumnSidecarsByRangeReqV1) FixedLength() uint64 {
+	return 0
+}
+
+func (d *DataColumnSidecarsByRangeReqV1) HashTreeRoot(hFn tree.HashFn) common.Root {
+	return hFn.HashTreeRoot(&d.StartSlot, &d.Count, &d.Columns)
+}
+
+// MaxResponseChunks is the maximum number of sidecars a peer may respond with: one per requested column per slot.
+func (d *DataColumnSidecarsByRangeReqV1) MaxResponseChunks(cfg *NetworkConfig) uint64 {
+	columns := uint64(len(d.Columns))
+	if columns == 0 {
+		return 0
+	}
+	// check before multiplying: a large count would overflow.
+	if uint64(d.Count) > cfg.MAX_REQUEST_DATA_COLUMN_SIDECARS/columns {
+		return cfg.MAX_REQUEST_DATA_COLUMN_SIDECARS
+	}
+	return uint64(d.Count) * columns
+}
+
+func (r *DataColumnSidecarsByRangeReqV1) String() string {
+	return fmt.Sprintf("%v", *r)
+}
+
+// DataColumnSidecarsByRangeRPCv1 serves data column sidecars, with the fork-digest of the sidecar slot as context-bytes.
+// Only the fork digests of fulu and later forks should be provided.
+func DataColumnSidecarsByRangeRPCv1(cfg *NetworkConfig, forkDigests []common.ForkDigest) *reqresp.Method {
+	minMax := make(map[common.ForkDigest]reqresp.MinMaxSize, len(forkDigests))
+	for _, digest := range forkDigests {
+		minMax[digest] = cfg.payloadMinMax(DataColumnSidecarMinMax)
+	}
+	return &reqresp.Method{
+		Protocol: reqresp.BeaconChainProtocol("data_column_sidecars_by_range", 1, reqresp.SnappyCompression{}),
+		RequestMinMax: reqresp.MinMaxSize{
+			Min: dataColumnsByRangeReqMinByteLen,
+			Max: dataColumnsByRangeReqMinByteLen + 8*NUMBER_OF_COLUMNS,
+		},
+		Compression:      reqresp.SnappyCompression{},
+		MaxPayloadSize:   cfg.MAX_PAYLOAD_SIZE,
+		ReadContextBytes: BlocksContext(minMax),
+		MaxResponseChunks: maxChunksOf(func(req *DataColumnSidecarsByRangeReqV1) uint64 {
+			return req.MaxResponseChunks(cfg)
+		}),
+	}
+}
+
+type DataColumnsByRootIdentifier struct {
+	BlockRoot common.Root
+	Columns   ColumnIndices
+}
+
+func (d *DataColumnsByRootIdentifier) Deserialize(dr *codec.DecodingReader) error {
+	return dr.Container(&d.BlockRoot, &d.Columns)
+}
+
+func (d *DataColumnsByRootIdentifier) Serialize(w *codec.EncodingWriter) error {
+	return w.Container(&d.BlockRoot, &d.Columns)
+}
+
+// block root, columns offset
+const dataColumnsByRootIdentifierMinByteLen = 32 + 4
+
+func (d *DataColumnsByRootIdentifier) ByteLength() uint64 {
+	return dataColumnsByRootIdentifierMinByteLen + d.Columns.ByteLength()
+}
+
+func (*DataColumnsByRootIdentifier) FixedLength() uint64 {
+	return 0
+}
+
+func (d *DataColumnsByRootIdentifier) HashTreeRoot(hFn tree.HashFn) common.Root {
+	return hFn.HashTreeRoot(&d.BlockRoot, &d.Columns)
+}
+
+// an identifier is encoded with an offset, since it is variable size
+const dataColumnsByRootIdentifierMaxByteLen = 4 + dataColumnsByRootIdentifierMinByteLen + 8*NUMBER_OF_COLUMNS
+
+// MAX_REQUEST_DATA_COLUMNS_BY_ROOT is the list limit of DataColumnSidecarsByRootReqV1,
+// the MAX_REQUEST_BLOCKS_DENEB of all public networks.
+const MAX_REQUEST_DATA_COLUMNS_BY_ROOT = 128
+
+type DataColumnSidecarsByRootReqV1 []DataColumnsByRootIdentifier
+
+func (a *DataColumnSidecarsByRootReqV1) Deserialize(dr *codec.DecodingReader) error {
+	return a.deserialize(dr, MAX_REQUEST_DATA_COLUMNS_BY_ROOT)
+}
+
+func (a *DataColumnSidecarsByRootReqV1) deserialize(dr *codec.DecodingReader, limit uint64) error {
+	return dr.List(func() codec.Deserializable {
+		i := len(*a)
+		*a = append(*a, DataColumnsByRootIdentifier{})
+		return &(*a)[i]
+	}, 0, limit)
+}
+
+// Limited decodes the request with the given list limit instead, such as the MAX_REQUEST_BLOCKS_DENEB of the network.
+func (a *DataColumnSidecarsByRootReqV1) Limited(limit uint64) codec.Deserializable {
+	return &limitedDataColumnsByRoot{req: a, limit: limit}
+}
+
+// limitedDataColumnsByRoot is the limitedReq of DataColumnSidecarsByRootReqV1.
+type limitedDataColumnsByRoot struct {
+	req   *DataColumnSidecarsByRootReqV1
+	limit uint64
+}
+
+func (l *limitedDataColumnsByRoot) Deserialize(dr *codec.DecodingReader) error {
+	return l.req.deserialize(dr, l.limit)
+}
+
+func (l *limitedDataColumnsByRoot) Serialize(w *codec.EncodingWriter) error {
+	return l.req.Serialize(w)
+}
+
+func (l *limitedDataColumnsByRoot) ByteLength() uint64 {
+	return l.req.ByteLength()
+}
+
+func (*limitedDataColumnsByRoot) FixedLength() uint64 {
+	return 0
+}
+
+func (l *limitedDataColumnsByRoot) request() codec.Serializable {
+	return l.req
+}
+
+func (a DataColumnSidecarsByRootReqV1) Serialize(w *codec.EncodingWriter) error {
+	return w.List(func(i uint64) codec.Serializable {
+		return &a[i]
+	}, 0, uint64(len(a)))
+}
+
+func (a DataColumnSidecarsByRootReqV1) ByteLength() (out uint64) {
+	for i := range a {
+		out += 4 + a[i].ByteLength()
+	}
+	return
+}
+
+func (a *DataColumnSidecarsByRootReqV1) FixedLength() uint64 {
+	return 0 // it's a list, no fixed length
+}
+
+// MaxResponseChunks is the maximum number of sidecars a peer may respond with: one per requested column per root.
+func (a DataColumnSidecarsByRootReqV1) MaxResponseChunks(cfg *NetworkConfig) (n uint64) {
+	for i := range a {
+		n += uint64(len(a[i].Columns))
+	}
+	return minUint64(n, cfg.MAX_REQUEST_DATA_COLUMN_SIDECARS)
+}
+
+func (r DataColumnSidecarsByRootReqV1) String() string {
+	if len(r) == 0 {
+		return "empty data-column-sidecars-by-root request"
+	}
+	var buf strings.Builder
+	buf.WriteString("data-column-sidecars-by-root requested: ")
+	for i := range r {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		fmt.Fprintf(&buf, "%s %v", r[i].BlockRoot, r[i].Columns)
+	}
+	return buf.String()
+}
+
+// DataColumnSidecarsByRootRPCv1 serves data column sidecars, with the fork-digest of the sidecar slot as context-bytes.
+// Only the fork digests of fulu and later forks should be provided.
+func DataColumnSidecarsByRootRPCv1(cfg *NetworkConfig, forkDigests []common.ForkDigest) *reqresp.Method {
+	minMax := make(map[common.ForkDigest]reqresp.MinMaxSize, len(forkDigests))
+	for _, digest := range forkDigests {
+		minMax[digest] = cfg.payloadMinMax(DataColumnSidecarMinMax)
+	}
+	return &reqresp.Method{
+		Protocol:         reqresp.BeaconChainProtocol("data_column_sidecars_by_root", 1, reqresp.SnappyCompression{}),
+		RequestMinMax:    reqresp.MinMaxSize{Min: 0, Max: cfg.MAX_REQUEST_BLOCKS_DENEB * dataColumnsByRootIdentifierMaxByteLen},
+		Compression:      reqresp.SnappyCompression{},
+		MaxPayloadSize:   cfg.MAX_PAYLOAD_SIZE,
+		ReadContextBytes: BlocksContext(minMax),
+		MaxResponseChunks: maxChunksOf(func(req *DataColumnSidecarsByRootReqV1) uint64 {
+			return req.MaxResponseChunks(cfg)
+		}),
+	}
+}
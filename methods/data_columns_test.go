@@ -0,0 +1,159 @@
+package methods
+
+import (
+	"bytes"
+	"context"
+	"github.com/libp2p/go-libp2p-core/peer"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/protolambda/go-eth2-reqresp/reqresp"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/view"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDataColumnSidecarsByRangeReqV1(t *testing.T) {
+	assert := assert.New(t)
+	req := &DataColumnSidecarsByRangeReqV1{StartSlot: 100, Count: 4, Columns: ColumnIndices{1, 5, 127}}
+	assert.Equal(uint64(12), req.MaxResponseChunks(MainnetNetworkConfig()))
+	huge := &DataColumnSidecarsByRangeReqV1{StartSlot: 100, Count: ^view.Uint64View(0), Columns: ColumnIndices{1, 5, 127}}
+	assert.Equal(MainnetNetworkConfig().MAX_REQUEST_DATA_COLUMN_SIDECARS, huge.MaxResponseChunks(MainnetNetworkConfig()))
+
+	var buf bytes.Buffer
+	assert.NoError(req.Serialize(codec.NewEncodingWriter(&buf)))
+	assert.Equal(req.ByteLength(), uint64(buf.Len()))
+
+	var got DataColumnSidecarsByRangeReqV1
+	assert.NoError(got.Deserialize(codec.NewDecodingReader(&buf, req.ByteLength())))
+	assert.Equal(*req, got)
+
+	method := DataColumnSidecarsByRangeRPCv1(MainnetNetworkConfig(), nil)
+	assert.NoError(method.RequestMinMax.Check(req.ByteLength()))
+}
+
+func TestDataColumnSidecar(t *testing.T) {
+	assert := assert.New(t)
+	sidecar := &DataColumnSidecar{
+		Index:          3,
+		Column:         DataColumn{Cell{1}, Cell{2}},
+		KZGCommitments: KZGCommitments{{3}, {4}},
+		KZGProofs:      KZGProofs{{5}, {6}},
+	}
+	sidecar.SignedBlockHeader.Message.Slot = 42
+	sidecar.KZGCommitmentsInclusionProof[2][0] = 7
+
+	var buf bytes.Buffer
+	assert.NoError(sidecar.Serialize(codec.NewEncodingWriter(&buf)))
+	size := sidecar.ByteLength()
+	assert.Equal(size, uint64(buf.Len()))
+	assert.NoError(DataColumnSidecarMinMax.Check(size))
+
+	var got DataColumnSidecar
+	assert.NoError(got.Deserialize(codec.NewDecodingReader(&buf, size)))
+	assert.Equal(*sidecar, got)
+
+	empty := new(DataColumnSidecar)
+	assert.Equal(DataColumnSidecarMinMax.Min, empty.ByteLength())
+}
+
+var fuluDigest = common.ForkDigest{0xcc}
+
+func TestDataColumnSidecarsByRootReqV1Limit(t *testing.T) {
+	assert := assert.New(t)
+	devnet := *MainnetNetworkConfig()
+	devnet.MAX_REQUEST_BLOCKS_DENEB = 256
+
+	req := make(DataColumnSidecarsByRootReqV1, MAX_REQUEST_DATA_COLUMNS_BY_ROOT+1)
+	for i := range req {
+		req[i] = DataColumnsByRootIdentifier{BlockRoot: common.Root{byte(i)}, Columns: ColumnIndices{1}}
+	}
+	var buf bytes.Buffer
+	assert.NoError(req.Serialize(codec.NewEncodingWriter(&buf)))
+	decode := func(dest codec.Deserializable) error {
+		return dest.Deserialize(codec.NewDecodingReader(bytes.NewReader(buf.Bytes()), uint64(buf.Len())))
+	}
+
+	// oversize requests are rejected
+	var got DataColumnSidecarsByRootReqV1
+	assert.Error(decode(&got))
+	got = nil
+	assert.Error(decode(got.Limited(MainnetNetworkConfig().MAX_REQUEST_BLOCKS_DENEB)))
+
+	got = nil
+	limited := got.Limited(devnet.MAX_REQUEST_BLOCKS_DENEB)
+	assert.NoError(decode(limited))
+	assert.Equal(req, got)
+	// the limited request arms the response chunk limit of the request
+	n, err := DataColumnSidecarsByRootRPCv1(&devnet, nil).MaxResponseChunks(limited.(codec.Serializable))
+	assert.NoError(err)
+	assert.Equal(uint64(len(req)), n)
+}
+
+func TestDataColumnSidecarsByRootRPCv1(t *testing.T) {
+	assert := assert.New(t)
+	method := DataColumnSidecarsByRootRPCv1(MainnetNetworkConfig(), []common.ForkDigest{fuluDigest})
+
+	req := DataColumnSidecarsByRootReqV1{
+		{BlockRoot: common.Root{1}, Columns: ColumnIndices{0, 64}},
+		{BlockRoot: common.Root{2}, Columns: ColumnIndices{3}},
+	}
+	assert.Equal(uint64(3), req.MaxResponseChunks(MainnetNetworkConfig()))
+	assert.NoError(method.RequestMinMax.Check(req.ByteLength()))
+
+	sidecarFor := func(root common.Root, index view.Uint64View) *DataColumnSidecar {
+		sidecar := &DataColumnSidecar{
+			Index:          index,
+			Column:         DataColumn{Cell{byte(index)}},
+			KZGCommitments: KZGCommitments{{root[0]}},
+			KZGProofs:      KZGProofs{{byte(index)}},
+		}
+		sidecar.SignedBlockHeader.Message.BodyRoot = root
+		return sidecar
+	}
+
+	mNet := mocknet.New()
+	peerA, err := mNet.GenPeer()
+	assert.NoError(err)
+	peerB, err := mNet.GenPeer()
+	assert.NoError(err)
+	assert.NoError(mNet.LinkAll())
+	assert.NoError(mNet.ConnectAllButSelf())
+
+	h := method.MakeStreamHandler(func() context.Context {
+		return context.Background()
+	}, func(ctx context.Context, peerId peer.ID, handler reqresp.ChunkedRequestHandler) {
+		var req DataColumnSidecarsByRootReqV1
+		if err := handler.ReadRequest(&req); err != nil {
+			_ = handler.WriteErrorChunk(reqresp.InvalidReqCode, "bad input")
+			return
+		}
+		for _, id := range req {
+			for _, index := range id.Columns {
+				assert.NoError(handler.StreamSSZ(reqresp.SuccessCode, fuluDigest[:], sidecarFor(id.BlockRoot, index)))
+			}
+		}
+	})
+	peerA.SetStreamHandler(method.Protocol, h)
+
+	var got []*DataColumnSidecar
+	err = method.RunRequest(context.Background(), peerB.NewStream, peerA.ID(), &req, req.MaxResponseChunks(MainnetNetworkConfig()),
+		func(chunk reqresp.ChunkedResponseHandler) error {
+			assert.Equal(reqresp.SuccessCode, chunk.ResultCode())
+			assert.Equal(fuluDigest[:], chunk.ContextBytes())
+			var sidecar DataColumnSidecar
+			if err := chunk.ReadObj(func(contextBytes []byte) (codec.Deserializable, error) {
+				return &sidecar, nil
+			}); err != nil {
+				return err
+			}
+			got = append(got, &sidecar)
+			return nil
+		})
+	assert.NoError(err)
+	assert.Equal([]*DataColumnSidecar{
+		sidecarFor(common.Root{1}, 0),
+		sidecarFor(common.Root{1}, 64),
+		sidecarFor(common.Root{2}, 3),
+	}, got)
+}
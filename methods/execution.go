@@ -0,0 +1,339 @@
+package methods
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/protolambda/go-eth2-reqresp/reqresp"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/merge"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
+	"github.com/protolambda/ztyp/view"
+)
+
+const MAX_EXTRA_DATA_BYTES = 32
+
+type ExtraData []byte
+
+func (e *ExtraData) Deserialize(dr *codec.DecodingReader) error {
+	return dr.ByteList((*[]byte)(e), MAX_EXTRA_DATA_BYTES)
+}
+
+func (e ExtraData) Serialize(w *codec.EncodingWriter) error {
+	return w.Write(e)
+}
+
+func (e ExtraData) ByteLength() uint64 {
+	return uint64(len(e))
+}
+
+func (*ExtraData) FixedLength() uint64 {
+	return 0
+}
+
+func (e ExtraData) HashTreeRoot(hFn tree.HashFn) common.Root {
+	return hFn.ByteListHTR(e, MAX_EXTRA_DATA_BYTES)
+}
+
+func (e ExtraData) String() string {
+	return "0x" + hex.EncodeToString(e)
+}
+
+// Uint256 is a little-endian encoded 256 bit unsigned integer.
+type Uint256 [32]byte
+
+func (u *Uint256) Deserialize(dr *codec.DecodingReader) error {
+	_, err := dr.Read(u[:])
+	return err
+}
+
+func (u *Uint256) Serialize(w *codec.EncodingWriter) error {
+	return w.Write(u[:])
+}
+
+func (Uint256) ByteLength() uint64 {
+	return 32
+}
+
+func (Uint256) FixedLength() uint64 {
+	return 32
+}
+
+func (u Uint256) HashTreeRoot(_ tree.HashFn) common.Root {
+	return common.Root(u)
+}
+
+// ExecutionPayloadHeader is the execution payload header as embedded in capella and later light client headers.
+// The blob-gas fields are only encoded for deneb and later, see LightClientFork.
+type ExecutionPayloadHeader struct {
+	ParentHash       common.Root
+	FeeRecipient     common.Eth1Address
+	StateRoot        common.Root
+	ReceiptsRoot     common.Root
+	LogsBloom        merge.LogsBloom
+	PrevRandao       common.Root
+	BlockNumber      view.Uint64View
+	GasLimit         view.Uint64View
+	GasUsed          view.Uint64View
+	Timestamp        common.Timestamp
+	ExtraData        ExtraData
+	BaseFeePerGas    Uint256
+	BlockHash        common.Root
+	TransactionsRoot common.Root
+	WithdrawalsRoot  common.Root
+	// Deneb and later
+	BlobGasUsed   view.Uint64View
+	ExcessBlobGas view.Uint64View
+}
+
+func (h *ExecutionPayloadHeader) fields(fork LightClientFork) []sszField {
+	fields := []sszField{
+		&h.ParentHash, &h.FeeRecipient, &h.StateRoot, &h.ReceiptsRoot, &h.LogsBloom, &h.PrevRandao,
+		&h.BlockNumber, &h.GasLimit, &h.GasUsed, &h.Timestamp, &h.ExtraData, &h.BaseFeePerGas,
+		&h.BlockHash, &h.TransactionsRoot, &h.WithdrawalsRoot,
+	}
+	if fork >= LightClientDeneb {
+		fields = append(fields, &h.BlobGasUsed, &h.ExcessBlobGas)
+	}
+	return fields
+}
+
+func (h *ExecutionPayloadHeader) withFork(fork LightClientFork) *forkedExecutionPayloadHeader {
+	return &forkedExecutionPayloadHeader{fork: fork, h: h}
+}
+
+func (h *ExecutionPayloadHeader) String() string {
+	return fmt.Sprintf("ExecutionPayloadHeader(number: %d, hash: %s)", h.BlockNumber, h.BlockHash)
+}
+
+// forkedExecutionPayloadHeader implements the SSZ encoding of an ExecutionPayloadHeader for a specific fork.
+type forkedExecutionPayloadHeader struct {
+	fork LightClientFork
+	h    *ExecutionPayloadHeader
+}
+
+func (f *forkedExecutionPayloadHeader) Deserialize(dr *codec.DecodingReader) error {
+	return dr.Container(deserializableFields(f.h.fields(f.fork))...)
+}
+
+func (f *forkedExecutionPayloadHeader) Serialize(w *codec.EncodingWriter) error {
+	return w.Container(serializableFields(f.h.fields(f.fork))...)
+}
+
+func (f *forkedExecutionPayloadHeader) ByteLength() uint64 {
+	return codec.ContainerLength(serializableFields(f.h.fields(f.fork))...)
+}
+
+func (*forkedExecutionPayloadHeader) FixedLength() uint64 {
+	return 0
+}
+
+func (f *forkedExecutionPayloadHeader) HashTreeRoot(hFn tree.HashFn) common.Root {
+	return hFn.HashTreeRoot(htrFields(f.h.fields(f.fork))...)
+}
+
+// capella fixed fields and extra-data offset
+const executionPayloadHeaderCapellaMinByteLen = 32 + 20 + 32 + 32 + merge.BYTES_PER_LOGS_BLOOM + 32 + 8*4 + 4 + 32 + 32 + 32 + 32
+
+// ExecutionPayloadHeaderMinMax is the size range of an encoded ExecutionPayloadHeader, for capella and later forks.
+func ExecutionPayloadHeaderMinMax(fork LightClientFork) (out reqresp.MinMaxSize) {
+	out.Min = executionPayloadHeaderCapellaMinByteLen
+	if fork >= LightClientDeneb {
+		out.Min += 8 + 8
+	}
+	out.Max = out.Min + MAX_EXTRA_DATA_BYTES
+	return
+}
+
+// Deneb and later execution payload preset values, mainnet.
+const (
+	MAX_BYTES_PER_TRANSACTION    = 1 << 30
+	MAX_TRANSACTIONS_PER_PAYLOAD = 1 << 20
+	MAX_WITHDRAWALS_PER_PAYLOAD  = 16
+)
+
+type Transaction []byte
+
+func (tx *Transaction) Deserialize(dr *codec.DecodingReader) error {
+	return dr.ByteList((*[]byte)(tx), MAX_BYTES_PER_TRANSACTION)
+}
+
+func (tx Transaction) Serialize(w *codec.EncodingWriter) error {
+	return w.Write(tx)
+}
+
+func (tx Transaction) ByteLength() uint64 {
+	return uint64(len(tx))
+}
+
+func (*Transaction) FixedLength() uint64 {
+	return 0
+}
+
+func (tx Transaction) HashTreeRoot(hFn tree.HashFn) common.Root {
+	return hFn.ByteListHTR(tx, MAX_BYTES_PER_TRANSACTION)
+}
+
+type Transactions []Transaction
+
+func (li *Transactions) Deserialize(dr *codec.DecodingReader) error {
+	return dr.List(func() codec.Deserializable {
+		i := len(*li)
+		*li = append(*li, Transaction{})
+		return &(*li)[i]
+	}, 0, MAX_TRANSACTIONS_PER_PAYLOAD)
+}
+
+func (li Transactions) Serialize(w *codec.EncodingWriter) error {
+	return w.List(func(i uint64) codec.Serializable {
+		return &li[i]
+	}, 0, uint64(len(li)))
+}
+
+func (li Transactions) ByteLength() (out uint64) {
+	for _, tx := range li {
+		out += tx.ByteLength() + codec.OFFSET_SIZE
+	}
+	return
+}
+
+func (*Transactions) FixedLength() uint64 {
+	return 0
+}
+
+func (li Transactions) HashTreeRoot(hFn tree.HashFn) common.Root {
+	length := uint64(len(li))
+	return hFn.ComplexListHTR(func(i uint64) tree.HTR {
+		if i < length {
+			return &li[i]
+		}
+		return nil
+	}, length, MAX_TRANSACTIONS_PER_PAYLOAD)
+}
+
+type Withdrawal struct {
+	Index          view.Uint64View
+	ValidatorIndex common.ValidatorIndex
+	Address        common.Eth1Address
+	Amount         common.Gwei
+}
+
+func (wd *Withdrawal) Deserialize(dr *codec.DecodingReader) error {
+	return dr.FixedLenContainer(&wd.Index, &wd.ValidatorIndex, &wd.Address, &wd.Amount)
+}
+
+func (wd *Withdrawal) Serialize(w *codec.EncodingWriter) error {
+	return w.FixedLenContainer(&wd.Index, &wd.ValidatorIndex, &wd.Address, &wd.Amount)
+}
+
+const withdrawalByteLen = 8 + 8 + 20 + 8
+
+func (*Withdrawal) ByteLength() uint64 {
+	return withdrawalByteLen
+}
+
+func (*Withdrawal) FixedLength() uint64 {
+	return withdrawalByteLen
+}
+
+func (wd *Withdrawal) HashTreeRoot(hFn tree.HashFn) common.Root {
+	return hFn.HashTreeRoot(&wd.Index, &wd.ValidatorIndex, &wd.Address, &wd.Amount)
+}
+
+type Withdrawals []Withdrawal
+
+func (li *Withdrawals) Deserialize(dr *codec.DecodingReader) error {
+	return dr.List(func() codec.Deserializable {
+		i := len(*li)
+		*li = append(*li, Withdrawal{})
+		return &(*li)[i]
+	}, withdrawalByteLen, MAX_WITHDRAWALS_PER_PAYLOAD)
+}
+
+func (li Withdrawals) Serialize(w *codec.EncodingWriter) error {
+	return w.List(func(i uint64) codec.Serializable {
+		return &li[i]
+	}, withdrawalByteLen, uint64(len(li)))
+}
+
+func (li Withdrawals) ByteLength() uint64 {
+	return uint64(len(li)) * withdrawalByteLen
+}
+
+func (*Withdrawals) FixedLength() uint64 {
+	return 0
+}
+
+func (li Withdrawals) HashTreeRoot(hFn tree.HashFn) common.Root {
+	length := uint64(len(li))
+	return hFn.ComplexListHTR(func(i uint64) tree.HTR {
+		if i < length {
+			return &li[i]
+		}
+		return nil
+	}, length, MAX_WITHDRAWALS_PER_PAYLOAD)
+}
+
+// ExecutionPayload is the deneb and later execution payload, as embedded in gloas execution payload envelopes.
+type ExecutionPayload struct {
+	ParentHash    common.Root
+	FeeRecipient  common.Eth1Address
+	StateRoot     common.Root
+	ReceiptsRoot  common.Root
+	LogsBloom     merge.LogsBloom
+	PrevRandao    common.Root
+	BlockNumber   view.Uint64View
+	GasLimit      view.Uint64View
+	GasUsed       view.Uint64View
+	Timestamp     common.Timestamp
+	ExtraData     ExtraData
+	BaseFeePerGas Uint256
+	BlockHash     common.Root
+	Transactions  Transactions
+	Withdrawals   Withdrawals
+	BlobGasUsed   view.Uint64View
+	ExcessBlobGas view.Uint64View
+}
+
+func (p *ExecutionPayload) fields() []sszField {
+	return []sszField{
+		&p.ParentHash, &p.FeeRecipient, &p.StateRoot, &p.ReceiptsRoot, &p.LogsBloom, &p.PrevRandao,
+		&p.BlockNumber, &p.GasLimit, &p.GasUsed, &p.Timestamp, &p.ExtraData, &p.BaseFeePerGas,
+		&p.BlockHash, &p.Transactions, &p.Withdrawals, &p.BlobGasUsed, &p.ExcessBlobGas,
+	}
+}
+
+func (p *ExecutionPayload) Deserialize(dr *codec.DecodingReader) error {
+	return dr.Container(deserializableFields(p.fields())...)
+}
+
+func (p *ExecutionPayload) Serialize(w *codec.EncodingWriter) error {
+	return w.Container(serializableFields(p.fields())...)
+}
+
+func (p *ExecutionPayload) ByteLength() uint64 {
+	return codec.ContainerLength(serializableFields(p.fields())...)
+}
+
+func (*ExecutionPayload) FixedLength() uint64 {
+	return 0
+}
+
+func (p *ExecutionPayload) HashTreeRoot(hFn tree.HashFn) common.Root {
+	return hFn.HashTreeRoot(htrFields(p.fields())...)
+}
+
+func (p *ExecutionPayload) String() string {
+	return fmt.Sprintf("ExecutionPayload(number: %d, hash: %s, txs: %d)", p.BlockNumber, p.BlockHash, len(p.Transactions))
+}
+
+// deneb fixed fields, and the extra-data, transactions and withdrawals offsets
+const executionPayloadMinByteLen = 32 + 20 + 32 + 32 + merge.BYTES_PER_LOGS_BLOOM + 32 + 8*4 + 4 + 32 + 32 + 4 + 4 + 8 + 8
+
+// ExecutionPayloadMinMax is the size range of an encoded deneb and later ExecutionPayload.
+var ExecutionPayloadMinMax = reqresp.MinMaxSize{
+	Min: executionPayloadMinByteLen,
+	Max: executionPayloadMinByteLen + MAX_EXTRA_DATA_BYTES +
+		MAX_TRANSACTIONS_PER_PAYLOAD*(codec.OFFSET_SIZE+MAX_BYTES_PER_TRANSACTION) +
+		MAX_WITHDRAWALS_PER_PAYLOAD*withdrawalByteLen,
+}
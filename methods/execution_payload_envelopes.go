@@ -0,0 +1,388 @@
+package methods
+
+import (
+	"fmt"
+	"github.com/protolambda/go-eth2-reqresp/reqresp"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
+	"github.com/protolambda/ztyp/view"
+)
+
+// Electra execution request preset values, mainnet.
+const (
+	MAX_DEPOSIT_REQUESTS_PER_PAYLOAD       = 8192
+	MAX_WITHDRAWAL_REQUESTS_PER_PAYLOAD    = 16
+	MAX_CONSOLIDATION_REQUESTS_PER_PAYLOAD = 2
+)
+
+type DepositRequest struct {
+	Pubkey                common.BLSPubkey
+	WithdrawalCredentials common.Root
+	Amount                common.Gwei
+	Signature             common.BLSSignature
+	Index                 view.Uint64View
+}
+
+func (d *DepositRequest) Deserialize(dr *codec.DecodingReader) error {
+	return dr.FixedLenContainer(&d.Pubkey, &d.WithdrawalCredentials, &d.Amount, &d.Signature, &d.Index)
+}
+
+func (d *DepositRequest) Serialize(w *codec.EncodingWriter) error {
+	return w.FixedLenContainer(&d.Pubkey, &d.WithdrawalCredentials, &d.Amount, &d.Signature, &d.Index)
+}
+
+const depositRequestByteLen = 48 + 32 + 8 + 96 + 8
+
+func (*DepositRequest) ByteLength() uint64 {
+	return depositRequestByteLen
+}
+
+func (*DepositRequest) FixedLength() uint64 {
+	return depositRequestByteLen
+}
+
+type DepositRequests []DepositRequest
+
+func (li *DepositRequests) Deserialize(dr *codec.DecodingReader) error {
+	return dr.List(func() codec.Deserializable {
+		i := len(*li)
+		*li = append(*li, DepositRequest{})
+		return &(*li)[i]
+	}, depositRequestByteLen, MAX_DEPOSIT_REQUESTS_PER_PAYLOAD)
+}
+
+func (li DepositRequests) Serialize(w *codec.EncodingWriter) error {
+	return w.List(func(i uint64) codec.Serializable {
+		return &li[i]
+	}, depositRequestByteLen, uint64(len(li)))
+}
+
+func (li DepositRequests) ByteLength() uint64 {
+	return uint64(len(li)) * depositRequestByteLen
+}
+
+func (*DepositRequests) FixedLength() uint64 {
+	return 0
+}
+
+type WithdrawalRequest struct {
+	SourceAddress   common.Eth1Address
+	ValidatorPubkey common.BLSPubkey
+	Amount          common.Gwei
+}
+
+func (d *WithdrawalRequest) Deserialize(dr *codec.DecodingReader) error {
+	return dr.FixedLenContainer(&d.SourceAddress, &d.ValidatorPubkey, &d.Amount)
+}
+
+func (d *WithdrawalRequest) Serialize(w *codec.EncodingWriter) error {
+	return w.FixedLenContainer(&d.SourceAddress, &d.ValidatorPubkey, &d.Amount)
+}
+
+const withdrawalRequestByteLen = 20 + 48 + 8
+
+func (*WithdrawalRequest) ByteLength() uint64 {
+	return withdrawalRequestByteLen
+}
+
+func (*WithdrawalRequest) FixedLength() uint64 {
+	return withdrawalRequestByteLen
+}
+
+type WithdrawalRequests []WithdrawalRequest
+
+func (li *WithdrawalRequests) Deserialize(dr *codec.DecodingReader) error {
+	return dr.List(func() codec.Deserializable {
+		i := len(*li)
+		*li = append(*li, WithdrawalRequest{})
+		return &(*li)[i]
+	}, withdrawalRequestByteLen, MAX_WITHDRAWAL_REQUESTS_PER_PAYLOAD)
+}
+
+func (li WithdrawalRequests) Serialize(w *codec.EncodingWriter) error {
+	return w.List(func(i uint64) codec.Serializable {
+		return &li[i]
+	}, withdrawalRequestByteLen, uint64(len(li)))
+}
+
+func (li WithdrawalRequests) ByteLength() uint64 {
+	return uint64(len(li)) * withdrawalRequestByteLen
+}
+
+func (*WithdrawalRequests) FixedLength() uint64 {
+	return 0
+}
+
+type ConsolidationRequest struct {
+	SourceAddress common.Eth1Address
+	SourcePubkey  common.BLSPubkey
+	TargetPubkey  common.BLSPubkey
+}
+
+func (d *ConsolidationRequest) Deserialize(dr *codec.DecodingReader) error {
+	return dr.FixedLenContainer(&d.SourceAddress, &d.SourcePubkey, &d.TargetPubkey)
+}
+
+func (d *ConsolidationRequest) Serialize(w *codec.EncodingWriter) error {
+	return w.FixedLenContainer(&d.SourceAddress, &d.SourcePubkey, &d.TargetPubkey)
+}
+
+const consolidationRequestByteLen = 20 + 48 + 48
+
+func (*ConsolidationRequest) ByteLength() uint64 {
+	return consolidationRequestByteLen
+}
+
+func (*ConsolidationRequest) FixedLength() uint64 {
+	return consolidationRequestByteLen
+}
+
+type ConsolidationRequests []ConsolidationRequest
+
+func (li *ConsolidationRequests) Deserialize(dr *codec.DecodingReader) error {
+	return dr.List(func() codec.Deserializable {
+		i := len(*li)
+		*li = append(*li, ConsolidationRequest{})
+		return &(*li)[i]
+	}, consolidationRequestByteLen, MAX_CONSOLIDATION_REQUESTS_PER_PAYLOAD)
+}
+
+func (li ConsolidationRequests) Serialize(w *codec.EncodingWriter) error {
+	return w.List(func(i uint64) codec.Serializable {
+		return &li[i]
+	}, consolidationRequestByteLen, uint64(len(li)))
+}
+
+func (li ConsolidationRequests) ByteLength() uint64 {
+	return uint64(len(li)) * consolidationRequestByteLen
+}
+
+func (*ConsolidationRequests) FixedLength() uint64 {
+	return 0
+}
+
+// ExecutionRequests are the electra and later execution layer triggered requests.
+type ExecutionRequests struct {
+	Deposits       DepositRequests
+	Withdrawals    WithdrawalRequests
+	Consolidations ConsolidationRequests
+}
+
+func (r *ExecutionRequests) Deserialize(dr *codec.DecodingReader) error {
+	return dr.Container(&r.Deposits, &r.Withdrawals, &r.Consolidations)
+}
+
+func (r *ExecutionRequests) Serialize(w *codec.EncodingWriter) error {
+	return w.Container(&r.Deposits, &r.Withdrawals, &r.Consolidations)
+}
+
+func (r *ExecutionRequests) ByteLength() uint64 {
+	return codec.ContainerLength(&r.Deposits, &r.Withdrawals, &r.Consolidations)
+}
+
+func (*ExecutionRequests) FixedLength() uint64 {
+	return 0
+}
+
+// three list offsets
+const executionRequestsMinByteLen = 4 + 4 + 4
+
+// ExecutionRequestsMinMax is the size range of encoded ExecutionRequests.
+var ExecutionRequestsMinMax = reqresp.MinMaxSize{
+	Min: executionRequestsMinByteLen,
+	Max: executionRequestsMinByteLen + MAX_DEPOSIT_REQUESTS_PER_PAYLOAD*depositRequestByteLen +
+		MAX_WITHDRAWAL_REQUESTS_PER_PAYLOAD*withdrawalRequestByteLen +
+		MAX_CONSOLIDATION_REQUESTS_PER_PAYLOAD*consolidationRequestByteLen,
+}
+
+// ExecutionPayloadEnvelope is the gloas (ePBS) envelope revealing the execution payload of a beacon block.
+type ExecutionPayloadEnvelope struct {
+	Payload            ExecutionPayload
+	ExecutionRequests  ExecutionRequests
+	BuilderIndex       view.Uint64View
+	BeaconBlockRoot    common.Root
+	Slot               common.Slot
+	BlobKZGCommitments KZGCommitments
+	StateRoot          common.Root
+}
+
+func (e *ExecutionPayloadEnvelope) Deserialize(dr *codec.DecodingReader) error {
+	return dr.Container(&e.Payload, &e.ExecutionRequests, &e.BuilderIndex, &e.BeaconBlockRoot, &e.Slot,
+		&e.BlobKZGCommitments, &e.StateRoot)
+}
+
+func (e *ExecutionPayloadEnvelope) Serialize(w *codec.EncodingWriter) error {
+	return w.Container(&e.Payload, &e.ExecutionRequests, &e.BuilderIndex, &e.BeaconBlockRoot, &e.Slot,
+		&e.BlobKZGCommitments, &e.StateRoot)
+}
+
+func (e *ExecutionPayloadEnvelope) ByteLength() uint64 {
+	return codec.ContainerLength(&e.Payload, &e.ExecutionRequests, &e.BuilderIndex, &e.BeaconBlockRoot, &e.Slot,
+		&e.BlobKZGCommitments, &e.StateRoot)
+}
+
+func (*ExecutionPayloadEnvelope) FixedLength() uint64 {
+	return 0
+}
+
+// payload, execution requests and commitments offsets, and the fixed fields
+const executionPayloadEnvelopeFixedByteLen = 4 + 4 + 8 + 32 + 8 + 4 + 32
+
+// ExecutionPayloadEnvelopeMinMax is the size range of an encoded ExecutionPayloadEnvelope.
+var ExecutionPayloadEnvelopeMinMax = reqresp.MinMaxSize{
+	Min: executionPayloadEnvelopeFixedByteLen + ExecutionPayloadMinMax.Min + ExecutionRequestsMinMax.Min,
+	Max: executionPayloadEnvelopeFixedByteLen + ExecutionPayloadMinMax.Max + ExecutionRequestsMinMax.Max +
+		MAX_BLOB_COMMITMENTS_PER_BLOCK*KZGCommitmentSize,
+}
+
+type SignedExecutionPayloadEnvelope struct {
+	Message   ExecutionPayloadEnvelope
+	Signature common.BLSSignature
+}
+
+func (e *SignedExecutionPayloadEnvelope) Deserialize(dr *codec.DecodingReader) error {
+	return dr.Container(&e.Message, &e.Signature)
+}
+
+func (e *SignedExecutionPayloadEnvelope) Serialize(w *codec.EncodingWriter) error {
+	return w.Container(&e.Message, &e.Signature)
+}
+
+func (e *SignedExecutionPayloadEnvelope) ByteLength() uint64 {
+	return codec.ContainerLength(&e.Message, &e.Signature)
+}
+
+func (*SignedExecutionPayloadEnvelope) FixedLength() uint64 {
+	return 0
+}
+
+func (e *SignedExecutionPayloadEnvelope) String() string {
+	return fmt.Sprintf("SignedExecutionPayloadEnvelope(slot: %d, block root: %s, builder: %d)",
+		e.Message.Slot, e.Message.BeaconBlockRoot, e.Message.BuilderIndex)
+}
+
+// message offset and signature
+const signedExecutionPayloadEnvelopeFixedByteLen = 4 + 96
+
+// SignedExecutionPayloadEnvelopeMinMax is the size range of an encoded SignedExecutionPayloadEnvelope.
+var SignedExecutionPayloadEnvelopeMinMax = reqresp.MinMaxSize{
+	Min: signedExecutionPayloadEnvelopeFixedByteLen + ExecutionPayloadEnvelopeMinMax.Min,
+	Max: signedExecutionPayloadEnvelopeFixedByteLen + ExecutionPayloadEnvelopeMinMax.Max,
+}
+
+// envelopesMinMax bounds the envelopes of every fork digest, limited to the max payload size.
+func (cfg *NetworkConfig) envelopesMinMax(forkDigests []common.ForkDigest) map[common.ForkDigest]reqresp.MinMaxSize {
+	minMax := make(map[common.ForkDigest]reqresp.MinMaxSize, len(forkDigests))
+	for _, digest := range forkDigests {
+		minMax[digest] = cfg.payloadMinMax(SignedExecutionPayloadEnvelopeMinMax)
+	}
+	return minMax
+}
+
+type ExecutionPayloadEnvelopesByRangeReqV1 struct {
+	StartSlot common.Slot
+	Count     view.Uint64View
+}
+
+func (d *ExecutionPayloadEnvelopesByRangeReqV1) Deserialize(dr *codec.DecodingReader) error {
+	return dr.FixedLenContainer(&d.StartSlot, &d.Count)
+}
+
+func (d *ExecutionPayloadEnvelopesByRangeReqV1) Serialize(w *codec.EncodingWriter) error {
+	return w.FixedLenContainer(&d.StartSlot, &d.Count)
+}
+
+const envelopesByRangeReqByteLen = 8 + 8
+
+func (d ExecutionPayloadEnvelopesByRangeReqV1) ByteLength() uint64 {
+	return envelopesByRangeReqByteLen
+}
+
+func (*ExecutionPayloadEnvelopesByRangeReqV1) FixedLength() uint64 {
+	return envelopesByRangeReqByteLen
+}
+
+func (d *ExecutionPayloadEnvelopesByRangeReqV1) HashTreeRoot(hFn tree.HashFn) common.Root {
+	return hFn.HashTreeRoot(&d.StartSlot, &d.Count)
+}
+
+// MaxResponseChunks is the maximum number of envelopes a peer may respond with.
+func (d *ExecutionPayloadEnvelopesByRangeReqV1) MaxResponseChunks(cfg *NetworkConfig) uint64 {
+	return minUint64(uint64(d.Count), cfg.MAX_REQUEST_BLOCKS_DENEB)
+}
+
+func (r *ExecutionPayloadEnvelopesByRangeReqV1) String() string {
+	return fmt.Sprintf("%v", *r)
+}
+
+// ExecutionPayloadEnvelopesByRangeRPCv1 serves signed execution payload envelopes (ePBS),
+// with the fork-digest of the envelope slot as context-bytes.
+// Only the fork digests of gloas and later forks should be provided.
+func ExecutionPayloadEnvelopesByRangeRPCv1(cfg *NetworkConfig, forkDigests []common.ForkDigest) *reqresp.Method {
+	return &reqresp.Method{
+		Protocol:         reqresp.BeaconChainProtocol("execution_payload_envelopes_by_range", 1, reqresp.SnappyCompression{}),
+		RequestMinMax:    reqresp.MinMaxSize{Min: envelopesByRangeReqByteLen, Max: envelopesByRangeReqByteLen},
+		Compression:      reqresp.SnappyCompression{},
+		MaxPayloadSize:   cfg.MAX_PAYLOAD_SIZE,
+		ReadContextBytes: BlocksContext(cfg.envelopesMinMax(forkDigests)),
+		MaxResponseChunks: maxChunksOf(func(req *ExecutionPayloadEnvelopesByRangeReqV1) uint64 {
+			return req.MaxResponseChunks(cfg)
+		}),
+	}
+}
+
+// MAX_REQUEST_PAYLOADS is the list limit of ExecutionPayloadEnvelopesByRootReqV1, the MAX_REQUEST_PAYLOADS of all public networks.
+const MAX_REQUEST_PAYLOADS = 128
+
+// ExecutionPayloadEnvelopesByRootReqV1 lists the beacon block roots to retrieve the payload envelopes of.
+type ExecutionPayloadEnvelopesByRootReqV1 []common.Root
+
+func (a *ExecutionPayloadEnvelopesByRootReqV1) Deserialize(dr *codec.DecodingReader) error {
+	return tree.ReadRootsLimited(dr, (*[]common.Root)(a), MAX_REQUEST_PAYLOADS)
+}
+
+// Limited decodes the request with the given list limit instead, such as the MAX_REQUEST_PAYLOADS of the network.
+func (a *ExecutionPayloadEnvelopesByRootReqV1) Limited(limit uint64) codec.Deserializable {
+	return &limitedRoots{req: a, roots: (*[]common.Root)(a), limit: limit}
+}
+
+func (a ExecutionPayloadEnvelopesByRootReqV1) Serialize(w *codec.EncodingWriter) error {
+	return tree.WriteRoots(w, a)
+}
+
+func (a ExecutionPayloadEnvelopesByRootReqV1) ByteLength() (out uint64) {
+	return uint64(len(a)) * 32
+}
+
+func (a *ExecutionPayloadEnvelopesByRootReqV1) FixedLength() uint64 {
+	return 0 // it's a list, no fixed length
+}
+
+// MaxResponseChunks is the maximum number of envelopes a peer may respond with.
+func (a ExecutionPayloadEnvelopesByRootReqV1) MaxResponseChunks(cfg *NetworkConfig) uint64 {
+	return minUint64(uint64(len(a)), cfg.MAX_REQUEST_PAYLOADS)
+}
+
+func (r ExecutionPayloadEnvelopesByRootReqV1) String() string {
+	if len(r) == 0 {
+		return "empty execution-payload-envelopes-by-root request"
+	}
+	return fmt.Sprintf("execution-payload-envelopes-by-root requested: %v", []common.Root(r))
+}
+
+// ExecutionPayloadEnvelopesByRootRPCv1 serves signed execution payload envelopes (ePBS) by beacon block root,
+// with the fork-digest of the envelope slot as context-bytes.
+// Only the fork digests of gloas and later forks should be provided.
+func ExecutionPayloadEnvelopesByRootRPCv1(cfg *NetworkConfig, forkDigests []common.ForkDigest) *reqresp.Method {
+	return &reqresp.Method{
+		Protocol:         reqresp.BeaconChainProtocol("execution_payload_envelopes_by_root", 1, reqresp.SnappyCompression{}),
+		RequestMinMax:    reqresp.MinMaxSize{Min: 0, Max: 32 * cfg.MAX_REQUEST_PAYLOADS},
+		Compression:      reqresp.SnappyCompression{},
+		MaxPayloadSize:   cfg.MAX_PAYLOAD_SIZE,
+		ReadContextBytes: BlocksContext(cfg.envelopesMinMax(forkDigests)),
+		MaxResponseChunks: maxChunksOf(func(req *ExecutionPayloadEnvelopesByRootReqV1) uint64 {
+			return req.MaxResponseChunks(cfg)
+		}),
+	}
+}
@@ -0,0 +1,141 @@
+package methods
+
+import (
+	"bytes"
+	"context"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/protolambda/go-eth2-reqresp/reqresp"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/view"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var gloasDigest = common.ForkDigest{0xff}
+
+func testEnvelope(slot common.Slot, root common.Root) *SignedExecutionPayloadEnvelope {
+	env := &SignedExecutionPayloadEnvelope{
+		Message: ExecutionPayloadEnvelope{
+			Payload: ExecutionPayload{
+				BlockNumber:  view.Uint64View(slot),
+				ExtraData:    ExtraData("envelope"),
+				Transactions: Transactions{{0x02, 0xaa}, {}, {0x01}},
+				Withdrawals:  Withdrawals{{Index: 7, ValidatorIndex: 3, Amount: 1000}},
+			},
+			ExecutionRequests: ExecutionRequests{
+				Deposits:       DepositRequests{{Amount: 32, Index: 1}},
+				Consolidations: ConsolidationRequests{{SourceAddress: common.Eth1Address{1}}},
+			},
+			BuilderIndex:       5,
+			BeaconBlockRoot:    root,
+			Slot:               slot,
+			BlobKZGCommitments: KZGCommitments{{1}, {2}},
+		},
+	}
+	env.Signature[0] = 0xc0
+	return env
+}
+
+func TestSignedExecutionPayloadEnvelope(t *testing.T) {
+	assert := assert.New(t)
+	env := testEnvelope(42, common.Root{1})
+
+	var buf bytes.Buffer
+	assert.NoError(env.Serialize(codec.NewEncodingWriter(&buf)))
+	size := env.ByteLength()
+	assert.Equal(size, uint64(buf.Len()))
+	assert.NoError(SignedExecutionPayloadEnvelopeMinMax.Check(size))
+
+	var got SignedExecutionPayloadEnvelope
+	assert.NoError(got.Deserialize(codec.NewDecodingReader(&buf, size)))
+	assert.Equal(*env, got)
+
+	empty := new(SignedExecutionPayloadEnvelope)
+	assert.Equal(SignedExecutionPayloadEnvelopeMinMax.Min, empty.ByteLength())
+}
+
+// serveEnvelopes runs the method against a server that responds with the envelopes made by the listener.
+func serveEnvelopes(t *testing.T, method *reqresp.Method, req codec.Serializable, maxChunks uint64,
+	listener reqresp.OnRequestListener) ([]*SignedExecutionPayloadEnvelope, error) {
+
+	server, client := testPeers(t)
+	server.SetStreamHandler(method.Protocol, method.MakeStreamHandler(func() context.Context {
+		return context.Background()
+	}, listener))
+
+	var got []*SignedExecutionPayloadEnvelope
+	err := method.RunRequest(context.Background(), client.NewStream, server.ID(), req, maxChunks,
+		func(chunk reqresp.ChunkedResponseHandler) error {
+			assert.Equal(t, gloasDigest[:], chunk.ContextBytes())
+			var env SignedExecutionPayloadEnvelope
+			if err := chunk.ReadObj(func(contextBytes []byte) (codec.Deserializable, error) {
+				return &env, nil
+			}); err != nil {
+				return err
+			}
+			got = append(got, &env)
+			return nil
+		})
+	return got, err
+}
+
+func TestExecutionPayloadEnvelopesByRangeRPCv1(t *testing.T) {
+	assert := assert.New(t)
+	method := ExecutionPayloadEnvelopesByRangeRPCv1(MainnetNetworkConfig(), []common.ForkDigest{gloasDigest})
+
+	req := &ExecutionPayloadEnvelopesByRangeReqV1{StartSlot: 100, Count: 3}
+	assert.NoError(method.RequestMinMax.Check(req.ByteLength()))
+
+	got, err := serveEnvelopes(t, method, req, req.MaxResponseChunks(MainnetNetworkConfig()),
+		func(ctx context.Context, peerId peer.ID, handler reqresp.ChunkedRequestHandler) {
+			var req ExecutionPayloadEnvelopesByRangeReqV1
+			if err := handler.ReadRequest(&req); err != nil {
+				_ = handler.WriteErrorChunk(reqresp.InvalidReqCode, "bad input")
+				return
+			}
+			for i := uint64(0); i < uint64(req.Count); i++ {
+				slot := req.StartSlot + common.Slot(i)
+				assert.NoError(handler.StreamSSZ(reqresp.SuccessCode, gloasDigest[:], testEnvelope(slot, common.Root{byte(slot)})))
+			}
+		})
+	assert.NoError(err)
+	assert.Equal([]*SignedExecutionPayloadEnvelope{
+		testEnvelope(100, common.Root{100}),
+		testEnvelope(101, common.Root{101}),
+		testEnvelope(102, common.Root{102}),
+	}, got)
+}
+
+func TestExecutionPayloadEnvelopesByRootRPCv1(t *testing.T) {
+	assert := assert.New(t)
+	method := ExecutionPayloadEnvelopesByRootRPCv1(MainnetNetworkConfig(), []common.ForkDigest{gloasDigest})
+
+	req := ExecutionPayloadEnvelopesByRootReqV1{{1}, {2}}
+	assert.NoError(method.RequestMinMax.Check(req.ByteLength()))
+
+	oversize := make(ExecutionPayloadEnvelopesByRootReqV1, MAX_REQUEST_PAYLOADS+1)
+	var buf bytes.Buffer
+	assert.NoError(oversize.Serialize(codec.NewEncodingWriter(&buf)))
+	var decoded ExecutionPayloadEnvelopesByRootReqV1
+	assert.Error(decoded.Deserialize(codec.NewDecodingReader(bytes.NewReader(buf.Bytes()), oversize.ByteLength())))
+	assert.NoError(decoded.Limited(MAX_REQUEST_PAYLOADS + 1).Deserialize(codec.NewDecodingReader(&buf, oversize.ByteLength())))
+	assert.Len(decoded, MAX_REQUEST_PAYLOADS+1)
+
+	got, err := serveEnvelopes(t, method, &req, req.MaxResponseChunks(MainnetNetworkConfig()),
+		func(ctx context.Context, peerId peer.ID, handler reqresp.ChunkedRequestHandler) {
+			var req ExecutionPayloadEnvelopesByRootReqV1
+			if err := handler.ReadRequest(&req); err != nil {
+				_ = handler.WriteErrorChunk(reqresp.InvalidReqCode, "bad input")
+				return
+			}
+			for i, root := range req {
+				assert.NoError(handler.StreamSSZ(reqresp.SuccessCode, gloasDigest[:], testEnvelope(common.Slot(i), root)))
+			}
+		})
+	assert.NoError(err)
+	assert.Equal([]*SignedExecutionPayloadEnvelope{
+		testEnvelope(0, common.Root{1}),
+		testEnvelope(1, common.Root{2}),
+	}, got)
+}
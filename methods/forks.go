@@ -0,0 +1,517 @@
+package methods
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"github.com/protolambda/go-eth2-reqresp/reqresp"
+	"github.com/protolambda/zrnt/eth2/beacon/altair"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
+	"sort"
+)
+
+// Fork is a consensus fork, in order of activation.
+type Fork uint8
+
+const (
+	ForkPhase0 Fork = iota
+	ForkAltair
+	ForkBellatrix
+	ForkCapella
+	ForkDeneb
+	ForkElectra
+	ForkFulu
+	ForkGloas
+)
+
+func (f Fork) String() string {
+	switch f {
+	case ForkPhase0:
+		return "phase0"
+	case ForkAltair:
+		return "altair"
+	case ForkBellatrix:
+		return "bellatrix"
+	case ForkCapella:
+		return "capella"
+	case ForkDeneb:
+		return "deneb"
+	case ForkElectra:
+		return "electra"
+	case ForkFulu:
+		return "fulu"
+	case ForkGloas:
+		return "gloas"
+	default:
+		return fmt.Sprintf("unknown fork %d", uint8(f))
+	}
+}
+
+// LightClientFork is the light client data layout used during the fork, if there is light client data.
+func (f Fork) LightClientFork() (LightClientFork, bool) {
+	switch f {
+	case ForkAltair, ForkBellatrix:
+		return LightClientAltair, true
+	case ForkCapella:
+		return LightClientCapella, true
+	case ForkDeneb:
+		return LightClientDeneb, true
+	case ForkElectra, ForkFulu:
+		return LightClientElectra, true
+	default:
+		return 0, false
+	}
+}
+
+// ScheduledFork is a fork with the version and epoch it activates with.
+type ScheduledFork struct {
+	Fork    Fork
+	Version common.Version
+	Epoch   common.Epoch
+}
+
+// SpecForkSchedule is the fork schedule as configured in the spec.
+// The zrnt spec config only schedules genesis and altair, later forks can be appended by the caller.
+func SpecForkSchedule(spec *common.Spec) []ScheduledFork {
+	return []ScheduledFork{
+		{Fork: ForkPhase0, Version: spec.GENESIS_FORK_VERSION, Epoch: common.GENESIS_EPOCH},
+		{Fork: ForkAltair, Version: spec.ALTAIR_FORK_VERSION, Epoch: spec.SlotToEpoch(spec.ALTAIR_FORK_SLOT)},
+	}
+}
+
+// MAX_BLOBS_PER_BLOCK_ELECTRA is the blob limit before the first blob-parameter-only fork, mainnet.
+const MAX_BLOBS_PER_BLOCK_ELECTRA = 9
+
+// BlobParameters is an entry of the blob schedule: the blob limit from the given epoch onwards.
+// Since fulu, changes of the blob parameters are blob-parameter-only (BPO) forks, with their own fork digest.
+type BlobParameters struct {
+	Epoch            common.Epoch
+	MaxBlobsPerBlock uint64
+}
+
+// DigestedFork is a scheduled fork with its fork digest.
+// BPO forks share the fork and version of the fork they happen in, but activate with their own epoch and digest.
+type DigestedFork struct {
+	ScheduledFork
+	Digest common.ForkDigest
+}
+
+// ForkDigests is a registry of the fork digests of a network, to look up the forked types and sizes by context-bytes.
+// Every scheduled fork resolves to its digest and back, but zrnt only defines the phase0 and altair blocks:
+// block digests of bellatrix and later forks are unknown to NewBlock, ReadBlock and BlocksMinMax.
+type ForkDigests struct {
+	Spec *common.Spec
+	// Forks are ordered by activation epoch.
+	Forks []DigestedFork
+}
+
+// NewForkDigests computes the fork digest of every fork in the schedule, for the network with the given genesis validators root.
+func NewForkDigests(spec *common.Spec, genesisValidatorsRoot common.Root, schedule []ScheduledFork) *ForkDigests {
+	return NewForkDigestsWithBlobSchedule(spec, genesisValidatorsRoot, schedule, nil)
+}
+
+// NewForkDigestsWithBlobSchedule computes the fork digest of every fork in the schedule, and of every BPO fork in the blob schedule,
+// for the network with the given genesis validators root.
+// Since fulu the blob parameters are mixed into the digest, before the first blob schedule entry the electra blob limit applies.
+func NewForkDigestsWithBlobSchedule(spec *common.Spec, genesisValidatorsRoot common.Root,
+	schedule []ScheduledFork, blobSchedule []BlobParameters) *ForkDigests {
+
+	forks := make([]ScheduledFork, len(schedule))
+	copy(forks, schedule)
+	sortForks := func() {
+		sort.SliceStable(forks, func(i, j int) bool {
+			if forks[i].Epoch == forks[j].Epoch {
+				return forks[i].Fork < forks[j].Fork
+			}
+			return forks[i].Epoch < forks[j].Epoch
+		})
+	}
+	sortForks()
+	forkAt := func(epoch common.Epoch) (out ScheduledFork, ok bool) {
+		for _, f := range forks {
+			if f.Epoch > epoch {
+				break
+			}
+			out, ok = f, true
+		}
+		return
+	}
+	fulu, hasFulu := scheduledFork(forks, ForkFulu)
+	electra, _ := scheduledFork(forks, ForkElectra)
+
+	blobs := make([]BlobParameters, len(blobSchedule))
+	copy(blobs, blobSchedule)
+	sort.SliceStable(blobs, func(i, j int) bool {
+		return blobs[i].Epoch < blobs[j].Epoch
+	})
+	blobParamsAt := func(epoch common.Epoch) BlobParameters {
+		out := BlobParameters{Epoch: electra.Epoch, MaxBlobsPerBlock: MAX_BLOBS_PER_BLOCK_ELECTRA}
+		for _, b := range blobs {
+			if b.Epoch > epoch {
+				break
+			}
+			out = b
+		}
+		return out
+	}
+
+	// BPO forks that do not coincide with a regular fork
+	if hasFulu {
+		for _, b := range blobs {
+			if b.Epoch <= fulu.Epoch {
+				continue
+			}
+			if f, ok := forkAt(b.Epoch); ok && f.Epoch != b.Epoch {
+				f.Epoch = b.Epoch
+				forks = append(forks, f)
+			}
+		}
+		sortForks()
+	}
+
+	out := make([]DigestedFork, 0, len(forks))
+	for _, f := range forks {
+		var digest common.ForkDigest
+		if hasFulu && f.Epoch >= fulu.Epoch {
+			digest = computeBlobForkDigest(f.Version, genesisValidatorsRoot, blobParamsAt(f.Epoch))
+		} else {
+			digest = common.ComputeForkDigest(f.Version, genesisValidatorsRoot)
+		}
+		out = append(out, DigestedFork{ScheduledFork: f, Digest: digest})
+	}
+	return &ForkDigests{Spec: spec, Forks: out}
+}
+
+func scheduledFork(schedule []ScheduledFork, fork Fork) (ScheduledFork, bool) {
+	for _, f := range schedule {
+		if f.Fork == fork {
+			return f, true
+		}
+	}
+	return ScheduledFork{}, false
+}
+
+// computeBlobForkDigest is the fulu fork digest: the fork data root, xor-ed with the hash of the blob parameters.
+func computeBlobForkDigest(version common.Version, genesisValidatorsRoot common.Root, params BlobParameters) (out common.ForkDigest) {
+	root := common.ComputeForkDataRoot(version, genesisValidatorsRoot)
+	var data [16]byte
+	binary.LittleEndian.PutUint64(data[:8], uint64(params.Epoch))
+	binary.LittleEndian.PutUint64(data[8:], params.MaxBlobsPerBlock)
+	h := sha256.Sum256(data[:])
+	for i := range out {
+		out[i] = root[i] ^ h[i]
+	}
+	return
+}
+
+// UnknownForkDigestError is returned when context-bytes do not match any fork digest known for the type of object.
+type UnknownForkDigestError struct {
+	ContextBytes []byte
+}
+
+func (e *UnknownForkDigestError) Error() string {
+	return fmt.Sprintf("unknown fork-digest: 0x%x", e.ContextBytes)
+}
+
+// toForkDigest converts context-bytes to a fork digest, or errors if the length does not match.
+func toForkDigest(contextBytes []byte) (digest common.ForkDigest, err error) {
+	if len(contextBytes) != len(digest) {
+		return digest, &UnknownForkDigestError{ContextBytes: contextBytes}
+	}
+	copy(digest[:], contextBytes)
+	return digest, nil
+}
+
+// Digest returns the fork digest of the given fork, if it is scheduled.
+func (fd *ForkDigests) Digest(fork Fork) (common.ForkDigest, bool) {
+	for _, f := range fd.Forks {
+		if f.Fork == fork {
+			return f.Digest, true
+		}
+	}
+	return common.ForkDigest{}, false
+}
+
+// Fork returns the fork of the given fork digest, if it is known.
+func (fd *ForkDigests) Fork(digest common.ForkDigest) (Fork, bool) {
+	for _, f := range fd.Forks {
+		if f.Digest == digest {
+			return f.Fork, true
+		}
+	}
+	return 0, false
+}
+
+// ForkAtEpoch returns the fork that is active at the given epoch, if any is scheduled by then.
+func (fd *ForkDigests) ForkAtEpoch(epoch common.Epoch) (out DigestedFork, ok bool) {
+	for _, f := range fd.Forks {
+		if f.Epoch > epoch {
+			break
+		}
+		out, ok = f, true
+	}
+	return
+}
+
+// DigestAtSlot returns the fork digest of the fork that is active at the given slot.
+func (fd *ForkDigests) DigestAtSlot(slot common.Slot) (common.ForkDigest, bool) {
+	f, ok := fd.ForkAtEpoch(fd.Spec.SlotToEpoch(slot))
+	return f.Digest, ok
+}
+
+func (fd *ForkDigests) minMax(fn func(fork Fork) (reqresp.MinMaxSize, bool)) map[common.ForkDigest]reqresp.MinMaxSize {
+	out := make(map[common.ForkDigest]reqresp.MinMaxSize, len(fd.Forks))
+	for _, f := range fd.Forks {
+		if mm, ok := fn(f.Fork); ok {
+			out[f.Digest] = mm
+		}
+	}
+	return out
+}
+
+func (fd *ForkDigests) blockType(fork Fork) (typ interface {
+	MinByteLength() uint64
+	MaxByteLength() uint64
+}, newBlock func() common.SpecObj, ok bool) {
+	switch fork {
+	case ForkPhase0:
+		return phase0.SignedBeaconBlockType(fd.Spec), func() common.SpecObj { return new(phase0.SignedBeaconBlock) }, true
+	case ForkAltair:
+		return altair.SignedBeaconBlockType(fd.Spec), func() common.SpecObj { return new(altair.SignedBeaconBlock) }, true
+	default:
+		// zrnt does not define the blocks of later forks yet: its merge package is a draft that predates altair.
+		return nil, nil, false
+	}
+}
+
+// BlocksMinMax is the size range of the signed beacon blocks per fork digest, for forks with known block types.
+func (fd *ForkDigests) BlocksMinMax() map[common.ForkDigest]reqresp.MinMaxSize {
+	return fd.minMax(func(fork Fork) (reqresp.MinMaxSize, bool) {
+		typ, _, ok := fd.blockType(fork)
+		if !ok {
+			return reqresp.MinMaxSize{}, false
+		}
+		return reqresp.MinMaxSize{Min: typ.MinByteLength(), Max: typ.MaxByteLength()}, true
+	})
+}
+
+// NewBlock creates a signed beacon block of the fork of the given digest.
+func (fd *ForkDigests) NewBlock(digest common.ForkDigest) (common.SpecObj, bool) {
+	fork, ok := fd.Fork(digest)
+	if !ok {
+		return nil, false
+	}
+	_, newBlock, ok := fd.blockType(fork)
+	if !ok {
+		return nil, false
+	}
+	return newBlock(), true
+}
+
+func hasBlobSidecars(fork Fork) bool {
+	return fork == ForkDeneb || fork == ForkElectra
+}
+
+// BlobSidecarsMinMax is the size range of the blob sidecars per fork digest, for deneb and electra.
+func (fd *ForkDigests) BlobSidecarsMinMax() map[common.ForkDigest]reqresp.MinMaxSize {
+	return fd.minMax(func(fork Fork) (reqresp.MinMaxSize, bool) {
+		return BlobSidecarMinMax, hasBlobSidecars(fork)
+	})
+}
+
+// NewBlobSidecar creates a blob sidecar of the fork of the given digest.
+func (fd *ForkDigests) NewBlobSidecar(digest common.ForkDigest) (*BlobSidecar, bool) {
+	fork, ok := fd.Fork(digest)
+	if !ok || !hasBlobSidecars(fork) {
+		return nil, false
+	}
+	return new(BlobSidecar), true
+}
+
+func hasDataColumnSidecars(fork Fork) bool {
+	return fork == ForkFulu || fork == ForkGloas
+}
+
+// DataColumnSidecarsMinMax is the size range of the data column sidecars per fork digest, for fulu and gloas.
+func (fd *ForkDigests) DataColumnSidecarsMinMax() map[common.ForkDigest]reqresp.MinMaxSize {
+	return fd.minMax(func(fork Fork) (reqresp.MinMaxSize, bool) {
+		return DataColumnSidecarMinMax, hasDataColumnSidecars(fork)
+	})
+}
+
+// NewDataColumnSidecar creates a data column sidecar of the fork of the given digest.
+func (fd *ForkDigests) NewDataColumnSidecar(digest common.ForkDigest) (*DataColumnSidecar, bool) {
+	fork, ok := fd.Fork(digest)
+	if !ok || !hasDataColumnSidecars(fork) {
+		return nil, false
+	}
+	return new(DataColumnSidecar), true
+}
+
+// LightClientForks maps the fork digests to the light client data layouts, for the light client methods.
+// The light client objects are constructed and sized per LightClientFork.
+func (fd *ForkDigests) LightClientForks() LightClientForks {
+	out := make(LightClientForks, len(fd.Forks))
+	for _, f := range fd.Forks {
+		if lf, ok := f.Fork.LightClientFork(); ok {
+			out[f.Digest] = lf
+		}
+	}
+	return out
+}
+
+// ReadBlock resolves the block type by context-bytes, to decode a response chunk with ChunkedResponseHandler.ReadObj.
+// The block is wrapped with the spec for decoding, and stored in dest.
+func (fd *ForkDigests) ReadBlock(dest *common.SpecObj) func(contextBytes []byte) (codec.Deserializable, error) {
+	return func(contextBytes []byte) (codec.Deserializable, error) {
+		digest, err := toForkDigest(contextBytes)
+		if err != nil {
+			return nil, err
+		}
+		block, ok := fd.NewBlock(digest)
+		if !ok {
+			return nil, &UnknownForkDigestError{ContextBytes: contextBytes}
+		}
+		*dest = block
+		return fd.Spec.Wrap(block), nil
+	}
+}
+
+// ReadBlobSidecar checks the context-bytes of a blob sidecar, to decode a response chunk with ChunkedResponseHandler.ReadObj.
+// The sidecar is stored in dest.
+func (fd *ForkDigests) ReadBlobSidecar(dest **BlobSidecar) func(contextBytes []byte) (codec.Deserializable, error) {
+	return func(contextBytes []byte) (codec.Deserializable, error) {
+		digest, err := toForkDigest(contextBytes)
+		if err != nil {
+			return nil, err
+		}
+		sidecar, ok := fd.NewBlobSidecar(digest)
+		if !ok {
+			return nil, &UnknownForkDigestError{ContextBytes: contextBytes}
+		}
+		*dest = sidecar
+		return sidecar, nil
+	}
+}
+
+// ReadDataColumnSidecar checks the context-bytes of a data column sidecar, to decode a response chunk with ChunkedResponseHandler.ReadObj.
+// The sidecar is stored in dest.
+func (fd *ForkDigests) ReadDataColumnSidecar(dest **DataColumnSidecar) func(contextBytes []byte) (codec.Deserializable, error) {
+	return func(contextBytes []byte) (codec.Deserializable, error) {
+		digest, err := toForkDigest(contextBytes)
+		if err != nil {
+			return nil, err
+		}
+		sidecar, ok := fd.NewDataColumnSidecar(digest)
+		if !ok {
+			return nil, &UnknownForkDigestError{ContextBytes: contextBytes}
+		}
+		*dest = sidecar
+		return sidecar, nil
+	}
+}
+
+// StreamAtSlot writes the object as success response chunk,
+// with the digest of the fork active at the given slot as context-bytes.
+func (fd *ForkDigests) StreamAtSlot(handler reqresp.ChunkedRequestHandler, slot common.Slot, obj codec.Serializable) error {
+	digest, ok := fd.DigestAtSlot(slot)
+	if !ok {
+		return fmt.Errorf("no fork scheduled at slot %d", slot)
+	}
+	return handler.StreamSSZ(reqresp.SuccessCode, digest[:], obj)
+}
+
+// BlockSlot returns the slot of the signed beacon block.
+func (fd *ForkDigests) BlockSlot(block common.SpecObj) (common.Slot, error) {
+	switch b := block.(type) {
+	case *phase0.SignedBeaconBlock:
+		return b.Message.Slot, nil
+	case *altair.SignedBeaconBlock:
+		return b.Message.Slot, nil
+	case interface {
+		SignedHeader(spec *common.Spec) *common.SignedBeaconBlockHeader
+	}:
+		return b.SignedHeader(fd.Spec).Message.Slot, nil
+	default:
+		return 0, fmt.Errorf("cannot determine slot of block type %T", block)
+	}
+}
+
+// BlockRoot returns the root of the signed beacon block: the hash-tree-root of the block message.
+func (fd *ForkDigests) BlockRoot(block common.SpecObj) (common.Root, error) {
+	switch b := block.(type) {
+	case *phase0.SignedBeaconBlock:
+		return b.Message.HashTreeRoot(fd.Spec, tree.GetHashFn()), nil
+	case *altair.SignedBeaconBlock:
+		return altairBlockRoot(fd.Spec, &b.Message), nil
+	case interface {
+		SignedHeader(spec *common.Spec) *common.SignedBeaconBlockHeader
+	}:
+		return b.SignedHeader(fd.Spec).Message.HashTreeRoot(tree.GetHashFn()), nil
+	default:
+		return common.Root{}, fmt.Errorf("cannot determine root of block type %T", block)
+	}
+}
+
+// altairBlockRoot is the hash-tree-root of the altair block.
+// The bitvector hashing of altair.SyncCommitteeBits only supports up to 256 bits, so the sync aggregate is hashed here.
+func altairBlockRoot(spec *common.Spec, block *altair.BeaconBlock) common.Root {
+	hFn := tree.GetHashFn()
+	body := &block.Body
+	bits := body.SyncAggregate.SyncCommitteeBits
+	chunks := (uint64(len(bits)) + 31) / 32
+	bitsRoot := hFn.ChunksHTR(func(i uint64) (out tree.Root) {
+		copy(out[:], bits[i*32:])
+		return
+	}, chunks, chunks)
+	bodyRoot := hFn.HashTreeRoot(
+		body.RandaoReveal, &body.Eth1Data,
+		body.Graffiti, spec.Wrap(&body.ProposerSlashings),
+		spec.Wrap(&body.AttesterSlashings), spec.Wrap(&body.Attestations),
+		spec.Wrap(&body.Deposits), spec.Wrap(&body.VoluntaryExits),
+		hFn.HashTreeRoot(bitsRoot, &body.SyncAggregate.SyncCommitteeSignature),
+	)
+	return hFn.HashTreeRoot(block.Slot, block.ProposerIndex, block.ParentRoot, block.StateRoot, bodyRoot)
+}
+
+// StreamBlock writes the signed beacon block as success response chunk, with the fork digest of the block slot as context-bytes.
+func (fd *ForkDigests) StreamBlock(handler reqresp.ChunkedRequestHandler, block common.SpecObj) error {
+	slot, err := fd.BlockSlot(block)
+	if err != nil {
+		return err
+	}
+	return fd.StreamAtSlot(handler, slot, fd.Spec.Wrap(block))
+}
+
+// StreamBlobSidecar writes the blob sidecar as success response chunk, with the fork digest of the sidecar slot as context-bytes.
+func (fd *ForkDigests) StreamBlobSidecar(handler reqresp.ChunkedRequestHandler, sidecar *BlobSidecar) error {
+	return fd.StreamAtSlot(handler, sidecar.SignedBlockHeader.Message.Slot, sidecar)
+}
+
+// StreamDataColumnSidecar writes the data column sidecar as success response chunk, with the fork digest of the sidecar slot as context-bytes.
+func (fd *ForkDigests) StreamDataColumnSidecar(handler reqresp.ChunkedRequestHandler, sidecar *DataColumnSidecar) error {
+	return fd.StreamAtSlot(handler, sidecar.SignedBlockHeader.Message.Slot, sidecar)
+}
+
+// BlobSidecarTypes is the context lookup of blob sidecars, to read their context-bytes with reqresp.ReadContext.
+func (fd *ForkDigests) BlobSidecarTypes() reqresp.ContextLookup {
+	return ForkDigestLookup(func(digest common.ForkDigest) (reqresp.ContextType, bool) {
+		fork, ok := fd.Fork(digest)
+		return reqresp.ContextType{MinMax: BlobSidecarMinMax, New: func() codec.Deserializable {
+			return new(BlobSidecar)
+		}}, ok && hasBlobSidecars(fork)
+	})
+}
+
+// DataColumnSidecarTypes is the context lookup of data column sidecars, to read their context-bytes with reqresp.ReadContext.
+func (fd *ForkDigests) DataColumnSidecarTypes() reqresp.ContextLookup {
+	return ForkDigestLookup(func(digest common.ForkDigest) (reqresp.ContextType, bool) {
+		fork, ok := fd.Fork(digest)
+		return reqresp.ContextType{MinMax: DataColumnSidecarMinMax, New: func() codec.Deserializable {
+			return new(DataColumnSidecar)
+		}}, ok && hasDataColumnSidecars(fork)
+	})
+}
@@ -0,0 +1,325 @@
+package methods
+
+import (
+	"bytes"
+	"context"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/protolambda/go-eth2-reqresp/reqresp"
+	"github.com/protolambda/zrnt/eth2/beacon/altair"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+	"github.com/protolambda/zrnt/eth2/configs"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func testForkDigests() *ForkDigests {
+	spec := configs.Mainnet
+	schedule := append(SpecForkSchedule(spec),
+		ScheduledFork{Fork: ForkFulu, Version: common.Version{6}, Epoch: 600},
+		ScheduledFork{Fork: ForkBellatrix, Version: common.Version{2}, Epoch: 200},
+		ScheduledFork{Fork: ForkCapella, Version: common.Version{3}, Epoch: 300},
+		ScheduledFork{Fork: ForkDeneb, Version: common.Version{4}, Epoch: 400},
+		ScheduledFork{Fork: ForkElectra, Version: common.Version{5}, Epoch: 500},
+	)
+	return NewForkDigests(spec, common.Root{0x42}, schedule)
+}
+
+func TestForkDigests(t *testing.T) {
+	assert := assert.New(t)
+	spec := configs.Mainnet
+	fd := testForkDigests()
+	digest := func(fork Fork) common.ForkDigest {
+		d, ok := fd.Digest(fork)
+		assert.True(ok, "fork %s must be scheduled", fork)
+		return d
+	}
+
+	if assert.Len(fd.Forks, 7) {
+		for i, f := range fd.Forks {
+			assert.Equal(Fork(i), f.Fork, "forks must be ordered by activation")
+			if f.Fork < ForkFulu {
+				assert.Equal(common.ComputeForkDigest(f.Version, common.Root{0x42}), f.Digest)
+			} else {
+				// without blob schedule, the electra blob limit is mixed into the digest
+				assert.Equal(computeBlobForkDigest(f.Version, common.Root{0x42},
+					BlobParameters{Epoch: 500, MaxBlobsPerBlock: MAX_BLOBS_PER_BLOCK_ELECTRA}), f.Digest)
+			}
+		}
+	}
+	fork, ok := fd.Fork(digest(ForkAltair))
+	assert.True(ok)
+	assert.Equal(ForkAltair, fork)
+	_, ok = fd.Digest(ForkGloas)
+	assert.False(ok)
+	_, ok = fd.Fork(common.ForkDigest{1, 2, 3, 4})
+	assert.False(ok)
+
+	blocks := fd.BlocksMinMax()
+	assert.Len(blocks, 2)
+	typ := altair.SignedBeaconBlockType(spec)
+	assert.Equal(typ.MinByteLength(), blocks[digest(ForkAltair)].Min)
+	assert.Equal(typ.MaxByteLength(), blocks[digest(ForkAltair)].Max)
+
+	for fork, expected := range map[Fork]common.SpecObj{
+		ForkPhase0: new(phase0.SignedBeaconBlock),
+		ForkAltair: new(altair.SignedBeaconBlock),
+	} {
+		block, ok := fd.NewBlock(digest(fork))
+		assert.True(ok)
+		assert.IsType(expected, block)
+	}
+	_, ok = fd.NewBlock(digest(ForkBellatrix))
+	assert.False(ok, "no bellatrix block type")
+
+	assert.Len(fd.BlobSidecarsMinMax(), 2)
+	assert.Equal(BlobSidecarMinMax, fd.BlobSidecarsMinMax()[digest(ForkDeneb)])
+	_, ok = fd.NewBlobSidecar(digest(ForkDeneb))
+	assert.True(ok)
+	_, ok = fd.NewBlobSidecar(digest(ForkFulu))
+	assert.False(ok)
+
+	assert.Len(fd.DataColumnSidecarsMinMax(), 1)
+	assert.Equal(DataColumnSidecarMinMax, fd.DataColumnSidecarsMinMax()[digest(ForkFulu)])
+	_, ok = fd.NewDataColumnSidecar(digest(ForkFulu))
+	assert.True(ok)
+
+	lcForks := fd.LightClientForks()
+	assert.Len(lcForks, 6)
+	assert.Equal(LightClientDeneb, lcForks[digest(ForkDeneb)])
+	assert.Equal(LightClientElectra, lcForks[digest(ForkFulu)])
+}
+
+func TestForkDigestsLaterForks(t *testing.T) {
+	assert := assert.New(t)
+	spec := configs.Mainnet
+	schedule := append(SpecForkSchedule(spec),
+		ScheduledFork{Fork: ForkBellatrix, Version: common.Version{2}, Epoch: 200},
+		ScheduledFork{Fork: ForkCapella, Version: common.Version{3}, Epoch: 300},
+		ScheduledFork{Fork: ForkDeneb, Version: common.Version{4}, Epoch: 400},
+		ScheduledFork{Fork: ForkElectra, Version: common.Version{5}, Epoch: 500},
+		ScheduledFork{Fork: ForkFulu, Version: common.Version{6}, Epoch: 600},
+		ScheduledFork{Fork: ForkGloas, Version: common.Version{7}, Epoch: 700},
+	)
+	fd := NewForkDigests(spec, common.Root{0x42}, schedule)
+
+	blocks := fd.BlocksMinMax()
+	for _, f := range fd.Forks {
+		fork, ok := fd.Fork(f.Digest)
+		assert.True(ok, "fork %s must resolve", f.Fork)
+		assert.Equal(f.Fork, fork)
+		if f.Fork > ForkAltair {
+			// zrnt does not define the blocks of these forks
+			_, ok = fd.NewBlock(f.Digest)
+			assert.False(ok, "no %s block type", f.Fork)
+			assert.NotContains(blocks, f.Digest)
+			var block common.SpecObj
+			_, err := fd.ReadBlock(&block)(f.Digest[:])
+			assert.IsType(&UnknownForkDigestError{}, err)
+		}
+	}
+
+	// data column sidecars continue in gloas
+	gloasDigest, _ := fd.Digest(ForkGloas)
+	fuluDigest, _ := fd.Digest(ForkFulu)
+	columns := fd.DataColumnSidecarsMinMax()
+	assert.Len(columns, 2)
+	assert.Equal(DataColumnSidecarMinMax, columns[fuluDigest])
+	assert.Equal(DataColumnSidecarMinMax, columns[gloasDigest])
+	var sidecar *DataColumnSidecar
+	_, err := fd.ReadDataColumnSidecar(&sidecar)(gloasDigest[:])
+	assert.NoError(err)
+}
+
+func TestBlobSidecar(t *testing.T) {
+	assert := assert.New(t)
+	sidecar := &BlobSidecar{Index: 3}
+	sidecar.Blob[0] = 0xab
+	sidecar.KZGCommitment[0] = 1
+	sidecar.SignedBlockHeader.Message.Slot = 123
+	sidecar.KZGCommitmentInclusionProof[16][0] = 7
+
+	var buf bytes.Buffer
+	assert.NoError(sidecar.Serialize(codec.NewEncodingWriter(&buf)))
+	assert.Equal(sidecar.ByteLength(), uint64(buf.Len()))
+	assert.NoError(BlobSidecarMinMax.Check(sidecar.ByteLength()))
+
+	var got BlobSidecar
+	assert.NoError(got.Deserialize(codec.NewDecodingReader(&buf, sidecar.ByteLength())))
+	assert.Equal(*sidecar, got)
+}
+
+func TestForkDigestsReadObj(t *testing.T) {
+	assert := assert.New(t)
+	fd := testForkDigests()
+	altairDigest, _ := fd.Digest(ForkAltair)
+	denebDigest, _ := fd.Digest(ForkDeneb)
+
+	var block common.SpecObj
+	dest, err := fd.ReadBlock(&block)(altairDigest[:])
+	assert.NoError(err)
+	assert.IsType(new(altair.SignedBeaconBlock), block)
+	assert.Equal(fd.Spec.Wrap(block), dest)
+
+	for _, contextBytes := range [][]byte{nil, {1, 2, 3}, denebDigest[:]} {
+		_, err = fd.ReadBlock(&block)(contextBytes)
+		assert.IsType(&UnknownForkDigestError{}, err)
+	}
+
+	var sidecar *BlobSidecar
+	dest, err = fd.ReadBlobSidecar(&sidecar)(denebDigest[:])
+	assert.NoError(err)
+	assert.Equal(sidecar, dest)
+	_, err = fd.ReadDataColumnSidecar(new(*DataColumnSidecar))(denebDigest[:])
+	if assert.IsType(&UnknownForkDigestError{}, err) {
+		assert.Equal(denebDigest[:], err.(*UnknownForkDigestError).ContextBytes)
+	}
+}
+
+func TestForkDigestsStreamBlock(t *testing.T) {
+	assert := assert.New(t)
+	spec := configs.Mainnet
+	fd := testForkDigests()
+
+	phase0Fork, _ := fd.ForkAtEpoch(0)
+	assert.Equal(ForkAltair, phase0Fork.Fork, "altair activates at genesis on mainnet")
+	fuluFork, _ := fd.ForkAtEpoch(1000)
+	assert.Equal(ForkFulu, fuluFork.Fork)
+	_, ok := (&ForkDigests{Spec: spec}).DigestAtSlot(0)
+	assert.False(ok)
+
+	// phase0 at genesis, altair one epoch later
+	fd = NewForkDigests(spec, common.Root{0x42}, []ScheduledFork{
+		{Fork: ForkPhase0, Version: common.Version{0}, Epoch: 0},
+		{Fork: ForkAltair, Version: common.Version{1}, Epoch: 1},
+	})
+	body := altair.BeaconBlockBody{SyncAggregate: altair.SyncAggregate{
+		SyncCommitteeBits: make(altair.SyncCommitteeBits, spec.SYNC_COMMITTEE_SIZE/8)}}
+	blocks := []common.SpecObj{
+		&phase0.SignedBeaconBlock{Message: phase0.BeaconBlock{Slot: spec.SLOTS_PER_EPOCH - 1}},
+		&altair.SignedBeaconBlock{Message: altair.BeaconBlock{Slot: spec.SLOTS_PER_EPOCH, Body: body}},
+	}
+
+	server, client := testPeers(t)
+	method := BlocksByRangeRPCv2(spec, MainnetNetworkConfig(), ForkAltair, fd.BlocksMinMax())
+	server.SetStreamHandler(method.Protocol, method.MakeStreamHandler(func() context.Context {
+		return context.Background()
+	}, func(ctx context.Context, peerId peer.ID, handler reqresp.ChunkedRequestHandler) {
+		var req BlocksByRangeReqV1
+		assert.NoError(handler.ReadRequest(&req))
+		for _, b := range blocks {
+			assert.NoError(fd.StreamBlock(handler, b))
+		}
+	}))
+
+	var got []common.SpecObj
+	req := &BlocksByRangeReqV1{StartSlot: spec.SLOTS_PER_EPOCH - 1, Count: 2, Step: 1}
+	err := method.RunRequest(context.Background(), client.NewStream, server.ID(), req, reqresp.MethodResponseChunks, func(chunk reqresp.ChunkedResponseHandler) error {
+		var block common.SpecObj
+		if err := chunk.ReadObj(fd.ReadBlock(&block)); err != nil {
+			return err
+		}
+		got = append(got, block)
+		return nil
+	})
+	assert.NoError(err)
+	assert.Equal(blocks, got)
+}
+
+func TestForkDigestsBlockRoot(t *testing.T) {
+	assert := assert.New(t)
+	// zrnt hashes sync committee bits of up to 256 bits correctly, like those of the minimal config.
+	spec := configs.Minimal
+	fd := &ForkDigests{Spec: spec}
+	bits := make(altair.SyncCommitteeBits, spec.SYNC_COMMITTEE_SIZE/8)
+	bits[0] = 0x81
+	block := &altair.SignedBeaconBlock{Message: altair.BeaconBlock{Slot: 5, ProposerIndex: 3, Body: altair.BeaconBlockBody{
+		Graffiti:      common.Root{1},
+		SyncAggregate: altair.SyncAggregate{SyncCommitteeBits: bits, SyncCommitteeSignature: common.BLSSignature{2}},
+	}}}
+	root, err := fd.BlockRoot(block)
+	assert.NoError(err)
+	assert.Equal(block.Message.HashTreeRoot(spec, tree.GetHashFn()), root)
+
+	phase0Block := &phase0.SignedBeaconBlock{Message: phase0.BeaconBlock{Slot: 5}}
+	root, err = fd.BlockRoot(phase0Block)
+	assert.NoError(err)
+	assert.Equal(phase0Block.Message.HashTreeRoot(spec, tree.GetHashFn()), root)
+
+	// mainnet sync committee bits are hashed too
+	mainnetBits := make(altair.SyncCommitteeBits, configs.Mainnet.SYNC_COMMITTEE_SIZE/8)
+	mainnetBits[63] = 0xff
+	_, err = (&ForkDigests{Spec: configs.Mainnet}).BlockRoot(&altair.SignedBeaconBlock{Message: altair.BeaconBlock{
+		Body: altair.BeaconBlockBody{SyncAggregate: altair.SyncAggregate{SyncCommitteeBits: mainnetBits}}}})
+	assert.NoError(err)
+
+	_, err = fd.BlockRoot(new(unknownBlock))
+	assert.Error(err)
+}
+
+func TestForkDigestsBlobSchedule(t *testing.T) {
+	assert := assert.New(t)
+	spec := configs.Mainnet
+	// the mainnet genesis validators root, fork schedule and blob schedule
+	gvr := common.Root{
+		0x4b, 0x36, 0x3d, 0xb9, 0x4e, 0x28, 0x61, 0x20, 0xd7, 0x6e, 0xb9, 0x05, 0x34, 0x0f, 0xdd, 0x4e,
+		0x54, 0xbf, 0xe9, 0xf0, 0x6b, 0xf3, 0x3f, 0xf6, 0xcf, 0x5a, 0xd2, 0x7f, 0x51, 0x1b, 0xfe, 0x95,
+	}
+	schedule := []ScheduledFork{
+		{Fork: ForkDeneb, Version: common.Version{4}, Epoch: 269568},
+		{Fork: ForkElectra, Version: common.Version{5}, Epoch: 364032},
+		{Fork: ForkFulu, Version: common.Version{6}, Epoch: 411392},
+	}
+	fd := NewForkDigestsWithBlobSchedule(spec, gvr, schedule, []BlobParameters{
+		{Epoch: 419072, MaxBlobsPerBlock: 21},
+		{Epoch: 412672, MaxBlobsPerBlock: 15},
+	})
+
+	assert.Equal([]DigestedFork{
+		{ScheduledFork: schedule[0], Digest: common.ForkDigest{0x6a, 0x95, 0xa1, 0xa9}},
+		{ScheduledFork: schedule[1], Digest: common.ForkDigest{0xad, 0x53, 0x2c, 0xeb}},
+		// the electra blob parameters apply at the fulu fork, before the first blob schedule entry
+		{ScheduledFork: schedule[2], Digest: common.ForkDigest{0xcc, 0x2c, 0x5c, 0xdb}},
+		{ScheduledFork: ScheduledFork{Fork: ForkFulu, Version: common.Version{6}, Epoch: 412672}, Digest: common.ForkDigest{0xcb, 0x0d, 0x1a, 0xcc}},
+		{ScheduledFork: ScheduledFork{Fork: ForkFulu, Version: common.Version{6}, Epoch: 419072}, Digest: common.ForkDigest{0x8c, 0x9f, 0x62, 0xfe}},
+	}, fd.Forks)
+
+	bpoDigest, ok := fd.DigestAtSlot(415000 * spec.SLOTS_PER_EPOCH)
+	assert.True(ok)
+	assert.Equal(fd.Forks[3].Digest, bpoDigest)
+	fork, ok := fd.Fork(bpoDigest)
+	assert.True(ok)
+	assert.Equal(ForkFulu, fork)
+
+	columns := fd.DataColumnSidecarsMinMax()
+	assert.Len(columns, 3)
+	assert.Equal(DataColumnSidecarMinMax, columns[bpoDigest])
+	var sidecar *DataColumnSidecar
+	_, err := fd.ReadDataColumnSidecar(&sidecar)(bpoDigest[:])
+	assert.NoError(err)
+	assert.Equal(LightClientElectra, fd.LightClientForks()[bpoDigest])
+}
+
+func TestForkDigestsSidecarTypes(t *testing.T) {
+	assert := assert.New(t)
+	fd := testForkDigests()
+	denebDigest, _ := fd.Digest(ForkDeneb)
+	fuluDigest, _ := fd.Digest(ForkFulu)
+
+	readContext := reqresp.ReadContext(4, fd.DataColumnSidecarTypes())
+	contextBytes, minMax, err := readContext(reqresp.NewBufLimitReader(bytes.NewReader(fuluDigest[:]), 1024, 0))
+	assert.NoError(err)
+	assert.Equal(fuluDigest[:], contextBytes)
+	assert.Equal(DataColumnSidecarMinMax, minMax)
+	_, _, err = readContext(reqresp.NewBufLimitReader(bytes.NewReader(denebDigest[:]), 1024, 0))
+	assert.Contains(err.Error(), "unknown fork-digest")
+
+	var dest codec.Deserializable
+	_, err = fd.BlobSidecarTypes().ReadObj(&dest)(denebDigest[:])
+	assert.NoError(err)
+	assert.IsType(new(BlobSidecar), dest)
+	_, err = fd.BlobSidecarTypes().ReadObj(&dest)(fuluDigest[:])
+	assert.IsType(&UnknownForkDigestError{}, err)
+}
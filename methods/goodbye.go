@@ -1,12 +1,145 @@
 package methods
 
 import (
+	"context"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/protolambda/go-eth2-reqresp/reqresp"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
+	"github.com/protolambda/ztyp/view"
+	"time"
 )
 
-var GoodbyeRPCv1 = reqresp.Method{
-	Protocol:         "/eth2/beacon_chain/req/goodbye/1/ssz_snappy",
-	RequestMinMax:    reqresp.MinMaxSize{Min: 8, Max: 8},
-	Compression:      reqresp.SnappyCompression{},
-	ReadContextBytes: NoContext(reqresp.MinMaxSize{Min: 8, Max: 8}),
+// GoodbyeReason is the reason for disconnecting: both the request and the (optional) response of the goodbye method.
+type GoodbyeReason uint64
+
+const (
+	GoodbyeClientShutdown    GoodbyeReason = 1
+	GoodbyeIrrelevantNetwork GoodbyeReason = 2
+	GoodbyeFaultError        GoodbyeReason = 3
+	// Client-specific reasons, commonly used by clients but not part of the spec.
+	GoodbyeUnableToVerifyNetwork GoodbyeReason = 128
+	GoodbyeTooManyPeers          GoodbyeReason = 129
+	GoodbyeBadScore              GoodbyeReason = 250
+	GoodbyeBanned                GoodbyeReason = 251
+)
+
+func (r GoodbyeReason) String() string {
+	switch r {
+	case GoodbyeClientShutdown:
+		return "client shutdown"
+	case GoodbyeIrrelevantNetwork:
+		return "irrelevant network"
+	case GoodbyeFaultError:
+		return "fault/error"
+	case GoodbyeUnableToVerifyNetwork:
+		return "unable to verify network"
+	case GoodbyeTooManyPeers:
+		return "too many peers"
+	case GoodbyeBadScore:
+		return "bad score"
+	case GoodbyeBanned:
+		return "banned"
+	default:
+		return fmt.Sprintf("unknown goodbye reason %d", uint64(r))
+	}
+}
+
+func (r *GoodbyeReason) Deserialize(dr *codec.DecodingReader) error {
+	return (*view.Uint64View)(r).Deserialize(dr)
+}
+
+func (r GoodbyeReason) Serialize(w *codec.EncodingWriter) error {
+	return w.WriteUint64(uint64(r))
+}
+
+func (GoodbyeReason) ByteLength() uint64 {
+	return 8
+}
+
+func (GoodbyeReason) FixedLength() uint64 {
+	return 8
+}
+
+func (r GoodbyeReason) HashTreeRoot(hFn tree.HashFn) common.Root {
+	return view.Uint64View(r).HashTreeRoot(hFn)
+}
+
+// GoodbyeRPCv1 sends the reason for disconnecting, the response is optional.
+func GoodbyeRPCv1(cfg *NetworkConfig) *reqresp.Method {
+	minMax := cfg.payloadMinMax(reqresp.MinMaxSize{Min: 8, Max: 8})
+	return &reqresp.Method{
+		Protocol:          reqresp.BeaconChainProtocol("goodbye", 1, reqresp.SnappyCompression{}),
+		RequestMinMax:     minMax,
+		Compression:       reqresp.SnappyCompression{},
+		MaxPayloadSize:    cfg.MAX_PAYLOAD_SIZE,
+		ReadContextBytes:  NoContext(minMax),
+		MaxResponseChunks: reqresp.SingleResponseChunk,
+	}
+}
+
+// RequestGoodbye sends the goodbye reason to the peer. The peer is not required to respond,
+// an absent response is not an error, but an error response is.
+func RequestGoodbye(ctx context.Context, cfg *NetworkConfig, newStreamFn reqresp.NewStreamFn, peerId peer.ID, reason GoodbyeReason) error {
+	return GoodbyeRPCv1(cfg).RunRequest(ctx, newStreamFn, peerId, reason, 1, func(chunk reqresp.ChunkedResponseHandler) error {
+		if chunk.ResultCode() != reqresp.SuccessCode {
+			return chunk.ReadErr()
+		}
+		return nil
+	})
+}
+
+type GoodbyeProvider interface {
+	// Goodbye is called when the peer says goodbye, with the reason it gave.
+	Goodbye(ctx context.Context, peerId peer.ID, reason GoodbyeReason)
+}
+
+// GoodbyeStreamHandler builds the stream handler of goodbye requests, served by ServeGoodbye.
+func GoodbyeStreamHandler(newCtx reqresp.StreamCtxFn, cfg *NetworkConfig, provider GoodbyeProvider) network.StreamHandler {
+	return GoodbyeRPCv1(cfg).MakeStreamHandler(newCtx, ServeGoodbye(provider))
+}
+
+// ServeGoodbye handles goodbye requests with the given provider. No response is sent.
+func ServeGoodbye(provider GoodbyeProvider) reqresp.OnRequestListener {
+	return func(ctx context.Context, peerId peer.ID, handler reqresp.ChunkedRequestHandler) {
+		var reason GoodbyeReason
+		if err := handler.ReadRequest(&reason); err != nil {
+			_ = handler.WriteErrorChunk(reqresp.InvalidReqCode, "could not parse goodbye request")
+			return
+		}
+		provider.Goodbye(ctx, peerId, reason)
+	}
+}
+
+// GoodbyeTimeout is the default time a peer gets to read our goodbye (and optionally respond) before we disconnect.
+const GoodbyeTimeout = 2 * time.Second
+
+// SayGoodbye sends a goodbye with the given reason to the peer, and then closes all connections to the peer.
+// Saying goodbye is best-effort: peers that do not answer within the timeout, or fail the request otherwise,
+// are disconnected all the same. A zero timeout defaults to GoodbyeTimeout.
+// Only an error to close the connections is returned.
+func SayGoodbye(ctx context.Context, cfg *NetworkConfig, h host.Host, peerId peer.ID, reason GoodbyeReason, timeout time.Duration) error {
+	if timeout == 0 {
+		timeout = GoodbyeTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		_ = RequestGoodbye(ctx, cfg, h.NewStream, peerId, reason)
+		close(done)
+	}()
+	// Reading the response does not watch the context, closing the connections stops it if the peer never answers.
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+	if err := h.Network().ClosePeer(peerId); err != nil {
+		return fmt.Errorf("failed to disconnect peer %s after goodbye (%s): %v", peerId, reason, err)
+	}
+	return nil
 }
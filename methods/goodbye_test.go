@@ -0,0 +1,39 @@
+package methods
+
+import (
+	"context"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestGoodbyeReason(t *testing.T) {
+	assert.Equal(t, "too many peers", GoodbyeTooManyPeers.String())
+	assert.Equal(t, "banned", GoodbyeBanned.String())
+	assert.Equal(t, "unknown goodbye reason 42", GoodbyeReason(42).String())
+}
+
+func TestSayGoodbye(t *testing.T) {
+	assert := assert.New(t)
+
+	server, client := testPeers(t)
+	// A peer that reads the goodbye but never answers or closes the stream.
+	received := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	server.SetStreamHandler(GoodbyeRPCv1(MainnetNetworkConfig()).Protocol, func(stream network.Stream) {
+		buf := make([]byte, 100)
+		_, _ = stream.Read(buf)
+		close(received)
+		<-release
+	})
+
+	timeout := 50 * time.Millisecond
+	start := time.Now()
+	assert.NoError(SayGoodbye(context.Background(), MainnetNetworkConfig(), client, server.ID(), GoodbyeClientShutdown, timeout))
+	assert.GreaterOrEqual(time.Since(start), timeout)
+	assert.Less(time.Since(start), GoodbyeTimeout)
+	<-received
+	assert.Equal(network.NotConnected, client.Network().Connectedness(server.ID()))
+}
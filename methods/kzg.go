@@ -0,0 +1,104 @@
+package methods
+
+import (
+	"encoding/hex"
+	"github.com/protolambda/ztyp/codec"
+)
+
+const KZGCommitmentSize = 48
+
+type KZGCommitment [KZGCommitmentSize]byte
+
+func (c *KZGCommitment) Deserialize(dr *codec.DecodingReader) error {
+	_, err := dr.Read(c[:])
+	return err
+}
+
+func (c *KZGCommitment) Serialize(w *codec.EncodingWriter) error {
+	return w.Write(c[:])
+}
+
+func (KZGCommitment) ByteLength() uint64 {
+	return KZGCommitmentSize
+}
+
+func (KZGCommitment) FixedLength() uint64 {
+	return KZGCommitmentSize
+}
+
+func (c KZGCommitment) String() string {
+	return "0x" + hex.EncodeToString(c[:])
+}
+
+const KZGProofSize = 48
+
+type KZGProof [KZGProofSize]byte
+
+func (p *KZGProof) Deserialize(dr *codec.DecodingReader) error {
+	_, err := dr.Read(p[:])
+	return err
+}
+
+func (p *KZGProof) Serialize(w *codec.EncodingWriter) error {
+	return w.Write(p[:])
+}
+
+func (KZGProof) ByteLength() uint64 {
+	return KZGProofSize
+}
+
+func (KZGProof) FixedLength() uint64 {
+	return KZGProofSize
+}
+
+func (p KZGProof) String() string {
+	return "0x" + hex.EncodeToString(p[:])
+}
+
+type KZGCommitments []KZGCommitment
+
+func (li *KZGCommitments) Deserialize(dr *codec.DecodingReader) error {
+	return dr.List(func() codec.Deserializable {
+		i := len(*li)
+		*li = append(*li, KZGCommitment{})
+		return &(*li)[i]
+	}, KZGCommitmentSize, MAX_BLOB_COMMITMENTS_PER_BLOCK)
+}
+
+func (li KZGCommitments) Serialize(w *codec.EncodingWriter) error {
+	return w.List(func(i uint64) codec.Serializable {
+		return &li[i]
+	}, KZGCommitmentSize, uint64(len(li)))
+}
+
+func (li KZGCommitments) ByteLength() uint64 {
+	return uint64(len(li)) * KZGCommitmentSize
+}
+
+func (*KZGCommitments) FixedLength() uint64 {
+	return 0
+}
+
+type KZGProofs []KZGProof
+
+func (li *KZGProofs) Deserialize(dr *codec.DecodingReader) error {
+	return dr.List(func() codec.Deserializable {
+		i := len(*li)
+		*li = append(*li, KZGProof{})
+		return &(*li)[i]
+	}, KZGProofSize, MAX_BLOB_COMMITMENTS_PER_BLOCK)
+}
+
+func (li KZGProofs) Serialize(w *codec.EncodingWriter) error {
+	return w.List(func(i uint64) codec.Serializable {
+		return &li[i]
+	}, KZGProofSize, uint64(len(li)))
+}
+
+func (li KZGProofs) ByteLength() uint64 {
+	return uint64(len(li)) * KZGProofSize
+}
+
+func (*KZGProofs) FixedLength() uint64 {
+	return 0
+}
@@ -0,0 +1,427 @@
+package methods
+
+import (
+	"context"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/protolambda/go-eth2-reqresp/reqresp"
+	"github.com/protolambda/zrnt/eth2/beacon/altair"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
+)
+
+// LightClientFork selects the fork-specific layout of light client objects.
+// Later forks without light client changes (e.g. bellatrix, fulu) reuse the layout of the preceding fork.
+type LightClientFork uint8
+
+const (
+	LightClientAltair LightClientFork = iota
+	LightClientCapella
+	LightClientDeneb
+	LightClientElectra
+)
+
+func (f LightClientFork) String() string {
+	switch f {
+	case LightClientAltair:
+		return "altair"
+	case LightClientCapella:
+		return "capella"
+	case LightClientDeneb:
+		return "deneb"
+	case LightClientElectra:
+		return "electra"
+	default:
+		return fmt.Sprintf("LightClientFork(%d)", uint8(f))
+	}
+}
+
+const EXECUTION_BRANCH_DEPTH = 4
+
+func (f LightClientFork) currentSyncCommitteeBranchDepth() uint64 {
+	if f >= LightClientElectra {
+		return 6
+	}
+	return 5
+}
+
+func (f LightClientFork) nextSyncCommitteeBranchDepth() uint64 {
+	if f >= LightClientElectra {
+		return 6
+	}
+	return 5
+}
+
+func (f LightClientFork) finalityBranchDepth() uint64 {
+	if f >= LightClientElectra {
+		return 7
+	}
+	return 6
+}
+
+// LightClientForks maps fork digests to the light client layout used for objects of that fork.
+type LightClientForks map[common.ForkDigest]LightClientFork
+
+func (lf LightClientForks) minMax(fn func(fork LightClientFork) reqresp.MinMaxSize) map[common.ForkDigest]reqresp.MinMaxSize {
+	out := make(map[common.ForkDigest]reqresp.MinMaxSize, len(lf))
+	for digest, fork := range lf {
+		out[digest] = fn(fork)
+	}
+	return out
+}
+
+// Fork returns the light client layout for the given context-bytes.
+func (lf LightClientForks) Fork(contextBytes []byte) (LightClientFork, error) {
+	digest, err := toForkDigest(contextBytes)
+	if err != nil {
+		return 0, err
+	}
+	fork, ok := lf[digest]
+	if !ok {
+		return 0, &UnknownForkDigestError{ContextBytes: contextBytes}
+	}
+	return fork, nil
+}
+
+// ReadObj resolves the light client layout by context-bytes, to decode a response chunk with ChunkedResponseHandler.ReadObj.
+// The object is created with makeObj, and wrapped with the spec for decoding.
+func (lf LightClientForks) ReadObj(spec *common.Spec, makeObj func(fork LightClientFork) common.SpecObj) func(contextBytes []byte) (codec.Deserializable, error) {
+	return func(contextBytes []byte) (codec.Deserializable, error) {
+		fork, err := lf.Fork(contextBytes)
+		if err != nil {
+			return nil, err
+		}
+		return spec.Wrap(makeObj(fork)), nil
+	}
+}
+
+// branch is a merkle branch of a fork-dependent, but fixed, depth.
+type branch struct {
+	roots *[]common.Root
+	depth uint64
+}
+
+func (b branch) Deserialize(dr *codec.DecodingReader) error {
+	return tree.ReadRoots(dr, b.roots, b.depth)
+}
+
+func (b branch) Serialize(w *codec.EncodingWriter) error {
+	if uint64(len(*b.roots)) != b.depth {
+		return fmt.Errorf("expected branch of depth %d, got %d", b.depth, len(*b.roots))
+	}
+	return tree.WriteRoots(w, *b.roots)
+}
+
+func (b branch) ByteLength() uint64 {
+	return b.depth * 32
+}
+
+func (b branch) FixedLength() uint64 {
+	return b.depth * 32
+}
+
+func (b branch) HashTreeRoot(hFn tree.HashFn) common.Root {
+	return hFn.ComplexVectorHTR(func(i uint64) tree.HTR {
+		return (*b.roots)[i]
+	}, b.depth)
+}
+
+// SyncCommittee is the sync committee as served to light clients.
+type SyncCommittee struct {
+	Pubkeys         []common.BLSPubkey
+	AggregatePubkey common.BLSPubkey
+}
+
+func (c *SyncCommittee) Deserialize(spec *common.Spec, dr *codec.DecodingReader) error {
+	c.Pubkeys = make([]common.BLSPubkey, spec.SYNC_COMMITTEE_SIZE)
+	for i := range c.Pubkeys {
+		if err := c.Pubkeys[i].Deserialize(dr); err != nil {
+			return fmt.Errorf("failed to decode sync committee pubkey %d: %v", i, err)
+		}
+	}
+	return c.AggregatePubkey.Deserialize(dr)
+}
+
+func (c *SyncCommittee) Serialize(spec *common.Spec, w *codec.EncodingWriter) error {
+	if uint64(len(c.Pubkeys)) != spec.SYNC_COMMITTEE_SIZE {
+		return fmt.Errorf("expected %d sync committee pubkeys, got %d", spec.SYNC_COMMITTEE_SIZE, len(c.Pubkeys))
+	}
+	for i := range c.Pubkeys {
+		if err := c.Pubkeys[i].Serialize(w); err != nil {
+			return err
+		}
+	}
+	return c.AggregatePubkey.Serialize(w)
+}
+
+func (c *SyncCommittee) ByteLength(spec *common.Spec) uint64 {
+	return (spec.SYNC_COMMITTEE_SIZE + 1) * 48
+}
+
+func (c *SyncCommittee) FixedLength(spec *common.Spec) uint64 {
+	return (spec.SYNC_COMMITTEE_SIZE + 1) * 48
+}
+
+func (c *SyncCommittee) HashTreeRoot(spec *common.Spec, hFn tree.HashFn) common.Root {
+	pubkeysRoot := hFn.ComplexVectorHTR(func(i uint64) tree.HTR {
+		return &c.Pubkeys[i]
+	}, spec.SYNC_COMMITTEE_SIZE)
+	return hFn.HashTreeRoot(pubkeysRoot, &c.AggregatePubkey)
+}
+
+// SyncAggregate is the sync aggregate as served to light clients.
+// Unlike altair.SyncAggregate it is encoded as a fixed-size container.
+type SyncAggregate struct {
+	SyncCommitteeBits      altair.SyncCommitteeBits
+	SyncCommitteeSignature common.BLSSignature
+}
+
+func (a *SyncAggregate) Deserialize(spec *common.Spec, dr *codec.DecodingReader) error {
+	return dr.FixedLenContainer(spec.Wrap(&a.SyncCommitteeBits), &a.SyncCommitteeSignature)
+}
+
+func (a *SyncAggregate) Serialize(spec *common.Spec, w *codec.EncodingWriter) error {
+	return w.FixedLenContainer(spec.Wrap(&a.SyncCommitteeBits), &a.SyncCommitteeSignature)
+}
+
+func syncAggregateByteLen(spec *common.Spec) uint64 {
+	return (spec.SYNC_COMMITTEE_SIZE+7)/8 + 96
+}
+
+func (a *SyncAggregate) ByteLength(spec *common.Spec) uint64 {
+	return syncAggregateByteLen(spec)
+}
+
+func (a *SyncAggregate) FixedLength(spec *common.Spec) uint64 {
+	return syncAggregateByteLen(spec)
+}
+
+func (a *SyncAggregate) HashTreeRoot(spec *common.Spec, hFn tree.HashFn) common.Root {
+	return hFn.HashTreeRoot(spec.Wrap(&a.SyncCommitteeBits), &a.SyncCommitteeSignature)
+}
+
+// LightClientHeader is the header of light client objects.
+// Altair only encodes the beacon block header, capella and later also encode the execution fields.
+type LightClientHeader struct {
+	Beacon common.BeaconBlockHeader
+	// Capella and later
+	Execution       ExecutionPayloadHeader
+	ExecutionBranch []common.Root
+}
+
+func (h *LightClientHeader) withFork(fork LightClientFork) *forkedLightClientHeader {
+	return &forkedLightClientHeader{fork: fork, h: h}
+}
+
+// forkedLightClientHeader implements the SSZ encoding of a LightClientHeader for a specific fork.
+type forkedLightClientHeader struct {
+	fork LightClientFork
+	h    *LightClientHeader
+}
+
+func (f *forkedLightClientHeader) executionBranch() branch {
+	return branch{roots: &f.h.ExecutionBranch, depth: EXECUTION_BRANCH_DEPTH}
+}
+
+func (f *forkedLightClientHeader) Deserialize(dr *codec.DecodingReader) error {
+	if f.fork == LightClientAltair {
+		return f.h.Beacon.Deserialize(dr)
+	}
+	return dr.Container(&f.h.Beacon, f.h.Execution.withFork(f.fork), f.executionBranch())
+}
+
+func (f *forkedLightClientHeader) Serialize(w *codec.EncodingWriter) error {
+	if f.fork == LightClientAltair {
+		return f.h.Beacon.Serialize(w)
+	}
+	return w.Container(&f.h.Beacon, f.h.Execution.withFork(f.fork), f.executionBranch())
+}
+
+func (f *forkedLightClientHeader) ByteLength() uint64 {
+	if f.fork == LightClientAltair {
+		return f.h.Beacon.ByteLength()
+	}
+	return codec.ContainerLength(&f.h.Beacon, f.h.Execution.withFork(f.fork), f.executionBranch())
+}
+
+func (f *forkedLightClientHeader) FixedLength() uint64 {
+	if f.fork == LightClientAltair {
+		return f.h.Beacon.FixedLength()
+	}
+	return 0
+}
+
+func (f *forkedLightClientHeader) HashTreeRoot(hFn tree.HashFn) common.Root {
+	if f.fork == LightClientAltair {
+		return hFn.HashTreeRoot(&f.h.Beacon)
+	}
+	return hFn.HashTreeRoot(&f.h.Beacon, f.h.Execution.withFork(f.fork), f.executionBranch())
+}
+
+const beaconBlockHeaderByteLen = 8 + 8 + 32 + 32 + 32
+
+func lightClientHeaderMinMax(fork LightClientFork) reqresp.MinMaxSize {
+	if fork == LightClientAltair {
+		return reqresp.MinMaxSize{Min: beaconBlockHeaderByteLen, Max: beaconBlockHeaderByteLen}
+	}
+	// beacon header, execution offset, execution branch
+	fixed := uint64(beaconBlockHeaderByteLen + 4 + EXECUTION_BRANCH_DEPTH*32)
+	exec := ExecutionPayloadHeaderMinMax(fork)
+	return reqresp.MinMaxSize{Min: fixed + exec.Min, Max: fixed + exec.Max}
+}
+
+// lightClientHeaderFieldMinMax is the size range the header takes up when embedded in a container,
+// including the offset if it is variable size.
+func lightClientHeaderFieldMinMax(fork LightClientFork) reqresp.MinMaxSize {
+	out := lightClientHeaderMinMax(fork)
+	if fork != LightClientAltair {
+		out.Min += 4
+		out.Max += 4
+	}
+	return out
+}
+
+// LightClientBootstrap is the bootstrap served to light clients for a trusted block root.
+// The Fork determines the encoding, and must be set before decoding.
+type LightClientBootstrap struct {
+	Fork                       LightClientFork
+	Header                     LightClientHeader
+	CurrentSyncCommittee       SyncCommittee
+	CurrentSyncCommitteeBranch []common.Root
+}
+
+func (b *LightClientBootstrap) fields(spec *common.Spec) []sszField {
+	return []sszField{
+		b.Header.withFork(b.Fork),
+		spec.Wrap(&b.CurrentSyncCommittee),
+		branch{roots: &b.CurrentSyncCommitteeBranch, depth: b.Fork.currentSyncCommitteeBranchDepth()},
+	}
+}
+
+func (b *LightClientBootstrap) Deserialize(spec *common.Spec, dr *codec.DecodingReader) error {
+	return dr.Container(deserializableFields(b.fields(spec))...)
+}
+
+func (b *LightClientBootstrap) Serialize(spec *common.Spec, w *codec.EncodingWriter) error {
+	return w.Container(serializableFields(b.fields(spec))...)
+}
+
+func (b *LightClientBootstrap) ByteLength(spec *common.Spec) uint64 {
+	return codec.ContainerLength(serializableFields(b.fields(spec))...)
+}
+
+func (b *LightClientBootstrap) FixedLength(spec *common.Spec) uint64 {
+	return fixedContainerLength(b.fields(spec))
+}
+
+func (b *LightClientBootstrap) HashTreeRoot(spec *common.Spec, hFn tree.HashFn) common.Root {
+	return hFn.HashTreeRoot(htrFields(b.fields(spec))...)
+}
+
+func (b *LightClientBootstrap) String() string {
+	return fmt.Sprintf("LightClientBootstrap(fork: %s, slot: %d)", b.Fork, b.Header.Beacon.Slot)
+}
+
+// LightClientBootstrapMinMax is the size range of an encoded LightClientBootstrap of the given fork.
+func LightClientBootstrapMinMax(spec *common.Spec, fork LightClientFork) reqresp.MinMaxSize {
+	fixed := (spec.SYNC_COMMITTEE_SIZE+1)*48 + fork.currentSyncCommitteeBranchDepth()*32
+	header := lightClientHeaderFieldMinMax(fork)
+	return reqresp.MinMaxSize{Min: fixed + header.Min, Max: fixed + header.Max}
+}
+
+type LightClientBootstrapReqV1 common.Root
+
+func (r *LightClientBootstrapReqV1) Deserialize(dr *codec.DecodingReader) error {
+	return (*common.Root)(r).Deserialize(dr)
+}
+
+func (r LightClientBootstrapReqV1) Serialize(w *codec.EncodingWriter) error {
+	return common.Root(r).Serialize(w)
+}
+
+func (LightClientBootstrapReqV1) ByteLength() uint64 {
+	return 32
+}
+
+func (LightClientBootstrapReqV1) FixedLength() uint64 {
+	return 32
+}
+
+func (r LightClientBootstrapReqV1) HashTreeRoot(hFn tree.HashFn) common.Root {
+	return common.Root(r)
+}
+
+func (r LightClientBootstrapReqV1) String() string {
+	return "light-client-bootstrap requested: " + common.Root(r).String()
+}
+
+// LightClientBootstrapRPCv1 serves the light client bootstrap of a block root,
+// with the fork-digest of the bootstrap header slot as context-bytes.
+func LightClientBootstrapRPCv1(spec *common.Spec, cfg *NetworkConfig, forks LightClientForks) *reqresp.Method {
+	return &reqresp.Method{
+		Protocol:       reqresp.BeaconChainProtocol("light_client_bootstrap", 1, reqresp.SnappyCompression{}),
+		RequestMinMax:  reqresp.MinMaxSize{Min: 32, Max: 32},
+		Compression:    reqresp.SnappyCompression{},
+		MaxPayloadSize: cfg.MAX_PAYLOAD_SIZE,
+		ReadContextBytes: BlocksContext(forks.minMax(func(fork LightClientFork) reqresp.MinMaxSize {
+			return cfg.payloadMinMax(LightClientBootstrapMinMax(spec, fork))
+		})),
+		MaxResponseChunks: reqresp.SingleResponseChunk,
+	}
+}
+
+// requestLightClientObj runs a request for a single light client object,
+// decoding it with the light client layout matching the context-bytes.
+func requestLightClientObj(ctx context.Context, m *reqresp.Method, spec *common.Spec, forks LightClientForks,
+	newStreamFn reqresp.NewStreamFn, peerId peer.ID, req codec.Serializable, makeObj func(fork LightClientFork) common.SpecObj) error {
+
+	return requestOne(ctx, m, newStreamFn, peerId, req, forks.ReadObj(spec, makeObj))
+}
+
+// serveLightClientObj responds with the light client object, or with a server error if err is not nil.
+func serveLightClientObj(spec *common.Spec, handler reqresp.ChunkedRequestHandler, obj common.SpecObj, digest common.ForkDigest, err error) {
+	if err != nil {
+		_ = handler.WriteErrorChunk(reqresp.ServerErrCode, err.Error())
+		return
+	}
+	_ = handler.StreamSSZ(reqresp.SuccessCode, digest[:], spec.Wrap(obj))
+}
+
+// RequestLightClientBootstrap requests the light client bootstrap for the given block root from the peer,
+// and decodes it with the light client layout matching the context-bytes.
+func RequestLightClientBootstrap(ctx context.Context, spec *common.Spec, cfg *NetworkConfig, forks LightClientForks,
+	newStreamFn reqresp.NewStreamFn, peerId peer.ID, blockRoot common.Root) (*LightClientBootstrap, error) {
+
+	var bootstrap *LightClientBootstrap
+	req := LightClientBootstrapReqV1(blockRoot)
+	err := requestLightClientObj(ctx, LightClientBootstrapRPCv1(spec, cfg, forks), spec, forks,
+		newStreamFn, peerId, &req, func(fork LightClientFork) common.SpecObj {
+			bootstrap = &LightClientBootstrap{Fork: fork}
+			return bootstrap
+		})
+	return bootstrap, err
+}
+
+type LightClientBootstrapProvider interface {
+	// LightClientBootstrap returns the bootstrap for the given block root, and the fork digest to serve it with.
+	// A nil bootstrap is served as unavailable resource.
+	LightClientBootstrap(ctx context.Context, blockRoot common.Root) (*LightClientBootstrap, common.ForkDigest, error)
+}
+
+// ServeLightClientBootstrap handles light client bootstrap requests with the given provider.
+func ServeLightClientBootstrap(spec *common.Spec, provider LightClientBootstrapProvider) reqresp.OnRequestListener {
+	return func(ctx context.Context, peerId peer.ID, handler reqresp.ChunkedRequestHandler) {
+		var req LightClientBootstrapReqV1
+		if err := handler.ReadRequest(&req); err != nil {
+			_ = handler.WriteErrorChunk(reqresp.InvalidReqCode, "could not parse light client bootstrap request")
+			return
+		}
+		bootstrap, digest, err := provider.LightClientBootstrap(ctx, common.Root(req))
+		if bootstrap == nil && err == nil {
+			_ = handler.WriteErrorChunk(reqresp.ResourceUnavailableCode, "light client bootstrap unavailable")
+			return
+		}
+		serveLightClientObj(spec, handler, bootstrap, digest, err)
+	}
+}
@@ -0,0 +1,222 @@
+package methods
+
+import (
+	"context"
+	"github.com/libp2p/go-libp2p-core/host"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/protolambda/go-eth2-reqresp/reqresp"
+	"github.com/protolambda/zrnt/eth2/beacon/altair"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/configs"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var capellaDigest = common.ForkDigest{0xdd}
+var denebDigest = common.ForkDigest{0xee}
+
+var testLightClientForks = LightClientForks{
+	altairDigest:  LightClientAltair,
+	capellaDigest: LightClientCapella,
+	denebDigest:   LightClientDeneb,
+	fuluDigest:    LightClientElectra,
+}
+
+func testLightClientHeader(fork LightClientFork, slot common.Slot) LightClientHeader {
+	h := LightClientHeader{Beacon: common.BeaconBlockHeader{Slot: slot}}
+	if fork != LightClientAltair {
+		h.Execution.BlockNumber = 123
+		h.Execution.ExtraData = ExtraData("hello")
+		if fork >= LightClientDeneb {
+			h.Execution.ExcessBlobGas = 42
+		}
+		h.ExecutionBranch = make([]common.Root, EXECUTION_BRANCH_DEPTH)
+	}
+	return h
+}
+
+func testLightClientBootstrap(spec *common.Spec, fork LightClientFork, slot common.Slot) *LightClientBootstrap {
+	return &LightClientBootstrap{
+		Fork:                       fork,
+		Header:                     testLightClientHeader(fork, slot),
+		CurrentSyncCommittee:       SyncCommittee{Pubkeys: make([]common.BLSPubkey, spec.SYNC_COMMITTEE_SIZE)},
+		CurrentSyncCommitteeBranch: make([]common.Root, fork.currentSyncCommitteeBranchDepth()),
+	}
+}
+
+type testBootstrapProvider map[common.Root]*LightClientBootstrap
+
+func (p testBootstrapProvider) LightClientBootstrap(ctx context.Context, blockRoot common.Root) (*LightClientBootstrap, common.ForkDigest, error) {
+	b, ok := p[blockRoot]
+	if !ok {
+		return nil, common.ForkDigest{}, nil
+	}
+	for digest, fork := range testLightClientForks {
+		if fork == b.Fork {
+			return b, digest, nil
+		}
+	}
+	panic("unknown fork")
+}
+
+func testPeers(t *testing.T) (a host.Host, b host.Host) {
+	mNet := mocknet.New()
+	a, err := mNet.GenPeer()
+	assert.NoError(t, err)
+	b, err = mNet.GenPeer()
+	assert.NoError(t, err)
+	assert.NoError(t, mNet.LinkAll())
+	assert.NoError(t, mNet.ConnectAllButSelf())
+	return a, b
+}
+
+func TestLightClientBootstrapRPCv1(t *testing.T) {
+	spec := configs.Mainnet
+	assert := assert.New(t)
+
+	provider := testBootstrapProvider{
+		common.Root{1}: testLightClientBootstrap(spec, LightClientAltair, 100),
+		common.Root{2}: testLightClientBootstrap(spec, LightClientDeneb, 200),
+	}
+	for _, b := range provider {
+		assert.NoError(LightClientBootstrapMinMax(spec, b.Fork).Check(b.ByteLength(spec)))
+	}
+
+	server, client := testPeers(t)
+	method := LightClientBootstrapRPCv1(spec, MainnetNetworkConfig(), testLightClientForks)
+	server.SetStreamHandler(method.Protocol, method.MakeStreamHandler(func() context.Context {
+		return context.Background()
+	}, ServeLightClientBootstrap(spec, provider)))
+
+	for root, expected := range provider {
+		got, err := RequestLightClientBootstrap(context.Background(), spec, MainnetNetworkConfig(), testLightClientForks,
+			client.NewStream, server.ID(), root)
+		assert.NoError(err)
+		assert.Equal(expected, got)
+	}
+
+	_, err := RequestLightClientBootstrap(context.Background(), spec, MainnetNetworkConfig(), testLightClientForks,
+		client.NewStream, server.ID(), common.Root{3})
+	if assert.IsType(&reqresp.ErrorResponse{}, err) {
+		assert.Equal(reqresp.ResourceUnavailableCode, err.(*reqresp.ErrorResponse).Code)
+	}
+}
+
+func testLightClientUpdate(spec *common.Spec, fork LightClientFork, slot common.Slot) *LightClientUpdate {
+	return &LightClientUpdate{
+		Fork:                    fork,
+		AttestedHeader:          testLightClientHeader(fork, slot),
+		NextSyncCommittee:       SyncCommittee{Pubkeys: make([]common.BLSPubkey, spec.SYNC_COMMITTEE_SIZE)},
+		NextSyncCommitteeBranch: make([]common.Root, fork.nextSyncCommitteeBranchDepth()),
+		FinalizedHeader:         testLightClientHeader(fork, slot-64),
+		FinalityBranch:          make([]common.Root, fork.finalityBranchDepth()),
+		SyncAggregate: SyncAggregate{
+			SyncCommitteeBits: make(altair.SyncCommitteeBits, spec.SYNC_COMMITTEE_SIZE/8),
+		},
+		SignatureSlot: slot + 1,
+	}
+}
+
+type testUpdatesProvider []*LightClientUpdate
+
+func (p testUpdatesProvider) LightClientUpdatesByRange(ctx context.Context, startPeriod uint64, count uint64) ([]ServedLightClientUpdate, error) {
+	var updates []ServedLightClientUpdate
+	for i := startPeriod; i < startPeriod+count && i < uint64(len(p)); i++ {
+		for digest, fork := range testLightClientForks {
+			if fork == p[i].Fork {
+				updates = append(updates, ServedLightClientUpdate{Update: p[i], Digest: digest})
+			}
+		}
+	}
+	return updates, nil
+}
+
+func TestLightClientUpdatesByRangeRPCv1(t *testing.T) {
+	spec := configs.Mainnet
+	assert := assert.New(t)
+
+	provider := testUpdatesProvider{
+		testLightClientUpdate(spec, LightClientAltair, 100),
+		testLightClientUpdate(spec, LightClientCapella, 200),
+		testLightClientUpdate(spec, LightClientElectra, 300),
+	}
+	for _, u := range provider {
+		assert.NoError(LightClientUpdateMinMax(spec, u.Fork).Check(u.ByteLength(spec)))
+	}
+
+	server, client := testPeers(t)
+	method := LightClientUpdatesByRangeRPCv1(spec, MainnetNetworkConfig(), testLightClientForks)
+	server.SetStreamHandler(method.Protocol, method.MakeStreamHandler(func() context.Context {
+		return context.Background()
+	}, ServeLightClientUpdatesByRange(spec, MainnetNetworkConfig(), provider)))
+
+	req := &LightClientUpdatesByRangeReqV1{StartPeriod: 1, Count: 10}
+	got, err := RequestLightClientUpdatesByRange(context.Background(), spec, MainnetNetworkConfig(), testLightClientForks,
+		client.NewStream, server.ID(), req)
+	assert.NoError(err)
+	assert.Equal([]*LightClientUpdate(provider[1:]), got)
+
+	req.Count = 1000
+	assert.Equal(MainnetNetworkConfig().MAX_REQUEST_LIGHT_CLIENT_UPDATES, req.MaxResponseChunks(MainnetNetworkConfig()))
+}
+
+type testLatestUpdatesProvider struct {
+	finality   *LightClientFinalityUpdate
+	optimistic *LightClientOptimisticUpdate
+}
+
+func (p *testLatestUpdatesProvider) LightClientFinalityUpdate(ctx context.Context) (*LightClientFinalityUpdate, common.ForkDigest, error) {
+	return p.finality, denebDigest, nil
+}
+
+func (p *testLatestUpdatesProvider) LightClientOptimisticUpdate(ctx context.Context) (*LightClientOptimisticUpdate, common.ForkDigest, error) {
+	return p.optimistic, denebDigest, nil
+}
+
+func TestLightClientFinalityAndOptimisticUpdateRPCv1(t *testing.T) {
+	spec := configs.Mainnet
+	assert := assert.New(t)
+
+	full := testLightClientUpdate(spec, LightClientDeneb, 300)
+	provider := &testLatestUpdatesProvider{
+		finality: &LightClientFinalityUpdate{
+			Fork:            full.Fork,
+			AttestedHeader:  full.AttestedHeader,
+			FinalizedHeader: full.FinalizedHeader,
+			FinalityBranch:  full.FinalityBranch,
+			SyncAggregate:   full.SyncAggregate,
+			SignatureSlot:   full.SignatureSlot,
+		},
+	}
+	assert.NoError(LightClientFinalityUpdateMinMax(spec, LightClientDeneb).Check(provider.finality.ByteLength(spec)))
+
+	server, client := testPeers(t)
+	finalityMethod := LightClientFinalityUpdateRPCv1(spec, MainnetNetworkConfig(), testLightClientForks)
+	server.SetStreamHandler(finalityMethod.Protocol, finalityMethod.MakeStreamHandler(func() context.Context {
+		return context.Background()
+	}, ServeLightClientFinalityUpdate(spec, provider)))
+	optimisticMethod := LightClientOptimisticUpdateRPCv1(spec, MainnetNetworkConfig(), testLightClientForks)
+	server.SetStreamHandler(optimisticMethod.Protocol, optimisticMethod.MakeStreamHandler(func() context.Context {
+		return context.Background()
+	}, ServeLightClientOptimisticUpdate(spec, provider)))
+
+	finality, err := RequestLightClientFinalityUpdate(context.Background(), spec, MainnetNetworkConfig(), testLightClientForks, client.NewStream, server.ID())
+	assert.NoError(err)
+	assert.Equal(provider.finality, finality)
+
+	_, err = RequestLightClientOptimisticUpdate(context.Background(), spec, MainnetNetworkConfig(), testLightClientForks, client.NewStream, server.ID())
+	if assert.IsType(&reqresp.ErrorResponse{}, err) {
+		assert.Equal(reqresp.ResourceUnavailableCode, err.(*reqresp.ErrorResponse).Code)
+	}
+
+	provider.optimistic = &LightClientOptimisticUpdate{
+		Fork:           full.Fork,
+		AttestedHeader: full.AttestedHeader,
+		SyncAggregate:  full.SyncAggregate,
+		SignatureSlot:  full.SignatureSlot,
+	}
+	assert.NoError(LightClientOptimisticUpdateMinMax(spec, LightClientDeneb).Check(provider.optimistic.ByteLength(spec)))
+	optimistic, err := RequestLightClientOptimisticUpdate(context.Background(), spec, MainnetNetworkConfig(), testLightClientForks, client.NewStream, server.ID())
+	assert.NoError(err)
+	assert.Equal(provider.optimistic, optimistic)
+}
@@ -0,0 +1,379 @@
+package methods
+
+import (
+	"context"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/protolambda/go-eth2-reqresp/reqresp"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
+	"github.com/protolambda/ztyp/view"
+)
+
+// LightClientUpdate is a light client update, as served per sync committee period.
+// The Fork determines the encoding, and must be set before decoding.
+type LightClientUpdate struct {
+	Fork                    LightClientFork
+	AttestedHeader          LightClientHeader
+	NextSyncCommittee       SyncCommittee
+	NextSyncCommitteeBranch []common.Root
+	FinalizedHeader         LightClientHeader
+	FinalityBranch          []common.Root
+	SyncAggregate           SyncAggregate
+	SignatureSlot           common.Slot
+}
+
+func (u *LightClientUpdate) fields(spec *common.Spec) []sszField {
+	return []sszField{
+		u.AttestedHeader.withFork(u.Fork),
+		spec.Wrap(&u.NextSyncCommittee),
+		branch{roots: &u.NextSyncCommitteeBranch, depth: u.Fork.nextSyncCommitteeBranchDepth()},
+		u.FinalizedHeader.withFork(u.Fork),
+		branch{roots: &u.FinalityBranch, depth: u.Fork.finalityBranchDepth()},
+		spec.Wrap(&u.SyncAggregate),
+		&u.SignatureSlot,
+	}
+}
+
+func (u *LightClientUpdate) Deserialize(spec *common.Spec, dr *codec.DecodingReader) error {
+	return dr.Container(deserializableFields(u.fields(spec))...)
+}
+
+func (u *LightClientUpdate) Serialize(spec *common.Spec, w *codec.EncodingWriter) error {
+	return w.Container(serializableFields(u.fields(spec))...)
+}
+
+func (u *LightClientUpdate) ByteLength(spec *common.Spec) uint64 {
+	return codec.ContainerLength(serializableFields(u.fields(spec))...)
+}
+
+func (u *LightClientUpdate) FixedLength(spec *common.Spec) uint64 {
+	return fixedContainerLength(u.fields(spec))
+}
+
+func (u *LightClientUpdate) HashTreeRoot(spec *common.Spec, hFn tree.HashFn) common.Root {
+	return hFn.HashTreeRoot(htrFields(u.fields(spec))...)
+}
+
+func (u *LightClientUpdate) String() string {
+	return fmt.Sprintf("LightClientUpdate(fork: %s, attested slot: %d, signature slot: %d)",
+		u.Fork, u.AttestedHeader.Beacon.Slot, u.SignatureSlot)
+}
+
+// LightClientUpdateMinMax is the size range of an encoded LightClientUpdate of the given fork.
+func LightClientUpdateMinMax(spec *common.Spec, fork LightClientFork) reqresp.MinMaxSize {
+	fixed := (spec.SYNC_COMMITTEE_SIZE+1)*48 +
+		fork.nextSyncCommitteeBranchDepth()*32 +
+		fork.finalityBranchDepth()*32 +
+		syncAggregateByteLen(spec) + 8
+	header := lightClientHeaderFieldMinMax(fork)
+	return reqresp.MinMaxSize{Min: fixed + 2*header.Min, Max: fixed + 2*header.Max}
+}
+
+type LightClientUpdatesByRangeReqV1 struct {
+	StartPeriod view.Uint64View
+	Count       view.Uint64View
+}
+
+func (d *LightClientUpdatesByRangeReqV1) Deserialize(dr *codec.DecodingReader) error {
+	return dr.FixedLenContainer(&d.StartPeriod, &d.Count)
+}
+
+func (d *LightClientUpdatesByRangeReqV1) Serialize(w *codec.EncodingWriter) error {
+	return w.FixedLenContainer(&d.StartPeriod, &d.Count)
+}
+
+const lightClientUpdatesByRangeReqByteLen = 8 + 8
+
+func (d LightClientUpdatesByRangeReqV1) ByteLength() uint64 {
+	return lightClientUpdatesByRangeReqByteLen
+}
+
+func (*LightClientUpdatesByRangeReqV1) FixedLength() uint64 {
+	return lightClientUpdatesByRangeReqByteLen
+}
+
+func (d *LightClientUpdatesByRangeReqV1) HashTreeRoot(hFn tree.HashFn) common.Root {
+	return hFn.HashTreeRoot(&d.StartPeriod, &d.Count)
+}
+
+// MaxResponseChunks is the maximum number of updates a peer may respond with.
+func (d *LightClientUpdatesByRangeReqV1) MaxResponseChunks(cfg *NetworkConfig) uint64 {
+	return minUint64(uint64(d.Count), cfg.MAX_REQUEST_LIGHT_CLIENT_UPDATES)
+}
+
+func (r *LightClientUpdatesByRangeReqV1) String() string {
+	return fmt.Sprintf("%v", *r)
+}
+
+// LightClientUpdatesByRangeRPCv1 serves the best light client update per sync committee period,
+// with the fork-digest of the update attested header slot as context-bytes.
+func LightClientUpdatesByRangeRPCv1(spec *common.Spec, cfg *NetworkConfig, forks LightClientForks) *reqresp.Method {
+	return &reqresp.Method{
+		Protocol:       reqresp.BeaconChainProtocol("light_client_updates_by_range", 1, reqresp.SnappyCompression{}),
+		RequestMinMax:  reqresp.MinMaxSize{Min: lightClientUpdatesByRangeReqByteLen, Max: lightClientUpdatesByRangeReqByteLen},
+		Compression:    reqresp.SnappyCompression{},
+		MaxPayloadSize: cfg.MAX_PAYLOAD_SIZE,
+		ReadContextBytes: BlocksContext(forks.minMax(func(fork LightClientFork) reqresp.MinMaxSize {
+			return cfg.payloadMinMax(LightClientUpdateMinMax(spec, fork))
+		})),
+		MaxResponseChunks: maxChunksOf(func(req *LightClientUpdatesByRangeReqV1) uint64 {
+			return req.MaxResponseChunks(cfg)
+		}),
+	}
+}
+
+// RequestLightClientUpdatesByRange requests light client updates from the peer,
+// and decodes each with the light client layout matching the context-bytes.
+// The updates received before any error are returned, along with the error.
+func RequestLightClientUpdatesByRange(ctx context.Context, spec *common.Spec, cfg *NetworkConfig, forks LightClientForks,
+	newStreamFn reqresp.NewStreamFn, peerId peer.ID, req *LightClientUpdatesByRangeReqV1) ([]*LightClientUpdate, error) {
+
+	var updates []*LightClientUpdate
+	err := LightClientUpdatesByRangeRPCv1(spec, cfg, forks).RunRequest(ctx, newStreamFn, peerId, req, req.MaxResponseChunks(cfg),
+		func(chunk reqresp.ChunkedResponseHandler) error {
+			if chunk.ResultCode() != reqresp.SuccessCode {
+				return chunk.ReadErr()
+			}
+			var update *LightClientUpdate
+			err := chunk.ReadObj(forks.ReadObj(spec, func(fork LightClientFork) common.SpecObj {
+				update = &LightClientUpdate{Fork: fork}
+				return update
+			}))
+			if err != nil {
+				return fmt.Errorf("failed to decode light client update %d: %v", chunk.ChunkIndex(), err)
+			}
+			updates = append(updates, update)
+			return nil
+		})
+	return updates, err
+}
+
+// ServedLightClientUpdate is a light client update, with the fork digest to serve it with.
+type ServedLightClientUpdate struct {
+	Update *LightClientUpdate
+	Digest common.ForkDigest
+}
+
+type LightClientUpdatesProvider interface {
+	// LightClientUpdatesByRange returns the best update of each period in the range, up to the first unavailable period.
+	LightClientUpdatesByRange(ctx context.Context, startPeriod uint64, count uint64) ([]ServedLightClientUpdate, error)
+}
+
+// ServeLightClientUpdatesByRange handles light client updates-by-range requests with the given provider.
+func ServeLightClientUpdatesByRange(spec *common.Spec, cfg *NetworkConfig, provider LightClientUpdatesProvider) reqresp.OnRequestListener {
+	return func(ctx context.Context, peerId peer.ID, handler reqresp.ChunkedRequestHandler) {
+		var req LightClientUpdatesByRangeReqV1
+		if err := handler.ReadRequest(&req); err != nil {
+			_ = handler.WriteErrorChunk(reqresp.InvalidReqCode, "could not parse light client updates request")
+			return
+		}
+		updates, err := provider.LightClientUpdatesByRange(ctx, uint64(req.StartPeriod), req.MaxResponseChunks(cfg))
+		if err != nil {
+			_ = handler.WriteErrorChunk(reqresp.ServerErrCode, err.Error())
+			return
+		}
+		if max := req.MaxResponseChunks(cfg); uint64(len(updates)) > max {
+			updates = updates[:max]
+		}
+		for _, u := range updates {
+			if err := handler.StreamSSZ(reqresp.SuccessCode, u.Digest[:], spec.Wrap(u.Update)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// LightClientFinalityUpdate is the latest finality update known to the server.
+// The Fork determines the encoding, and must be set before decoding.
+type LightClientFinalityUpdate struct {
+	Fork            LightClientFork
+	AttestedHeader  LightClientHeader
+	FinalizedHeader LightClientHeader
+	FinalityBranch  []common.Root
+	SyncAggregate   SyncAggregate
+	SignatureSlot   common.Slot
+}
+
+func (u *LightClientFinalityUpdate) fields(spec *common.Spec) []sszField {
+	return []sszField{
+		u.AttestedHeader.withFork(u.Fork),
+		u.FinalizedHeader.withFork(u.Fork),
+		branch{roots: &u.FinalityBranch, depth: u.Fork.finalityBranchDepth()},
+		spec.Wrap(&u.SyncAggregate),
+		&u.SignatureSlot,
+	}
+}
+
+func (u *LightClientFinalityUpdate) Deserialize(spec *common.Spec, dr *codec.DecodingReader) error {
+	return dr.Container(deserializableFields(u.fields(spec))...)
+}
+
+func (u *LightClientFinalityUpdate) Serialize(spec *common.Spec, w *codec.EncodingWriter) error {
+	return w.Container(serializableFields(u.fields(spec))...)
+}
+
+func (u *LightClientFinalityUpdate) ByteLength(spec *common.Spec) uint64 {
+	return codec.ContainerLength(serializableFields(u.fields(spec))...)
+}
+
+func (u *LightClientFinalityUpdate) FixedLength(spec *common.Spec) uint64 {
+	return fixedContainerLength(u.fields(spec))
+}
+
+func (u *LightClientFinalityUpdate) HashTreeRoot(spec *common.Spec, hFn tree.HashFn) common.Root {
+	return hFn.HashTreeRoot(htrFields(u.fields(spec))...)
+}
+
+func (u *LightClientFinalityUpdate) String() string {
+	return fmt.Sprintf("LightClientFinalityUpdate(fork: %s, attested slot: %d, finalized slot: %d)",
+		u.Fork, u.AttestedHeader.Beacon.Slot, u.FinalizedHeader.Beacon.Slot)
+}
+
+// LightClientFinalityUpdateMinMax is the size range of an encoded LightClientFinalityUpdate of the given fork.
+func LightClientFinalityUpdateMinMax(spec *common.Spec, fork LightClientFork) reqresp.MinMaxSize {
+	fixed := fork.finalityBranchDepth()*32 + syncAggregateByteLen(spec) + 8
+	header := lightClientHeaderFieldMinMax(fork)
+	return reqresp.MinMaxSize{Min: fixed + 2*header.Min, Max: fixed + 2*header.Max}
+}
+
+// LightClientOptimisticUpdate is the latest optimistic update known to the server.
+// The Fork determines the encoding, and must be set before decoding.
+type LightClientOptimisticUpdate struct {
+	Fork           LightClientFork
+	AttestedHeader LightClientHeader
+	SyncAggregate  SyncAggregate
+	SignatureSlot  common.Slot
+}
+
+func (u *LightClientOptimisticUpdate) fields(spec *common.Spec) []sszField {
+	return []sszField{
+		u.AttestedHeader.withFork(u.Fork),
+		spec.Wrap(&u.SyncAggregate),
+		&u.SignatureSlot,
+	}
+}
+
+func (u *LightClientOptimisticUpdate) Deserialize(spec *common.Spec, dr *codec.DecodingReader) error {
+	return dr.Container(deserializableFields(u.fields(spec))...)
+}
+
+func (u *LightClientOptimisticUpdate) Serialize(spec *common.Spec, w *codec.EncodingWriter) error {
+	return w.Container(serializableFields(u.fields(spec))...)
+}
+
+func (u *LightClientOptimisticUpdate) ByteLength(spec *common.Spec) uint64 {
+	return codec.ContainerLength(serializableFields(u.fields(spec))...)
+}
+
+func (u *LightClientOptimisticUpdate) FixedLength(spec *common.Spec) uint64 {
+	return fixedContainerLength(u.fields(spec))
+}
+
+func (u *LightClientOptimisticUpdate) HashTreeRoot(spec *common.Spec, hFn tree.HashFn) common.Root {
+	return hFn.HashTreeRoot(htrFields(u.fields(spec))...)
+}
+
+func (u *LightClientOptimisticUpdate) String() string {
+	return fmt.Sprintf("LightClientOptimisticUpdate(fork: %s, attested slot: %d, signature slot: %d)",
+		u.Fork, u.AttestedHeader.Beacon.Slot, u.SignatureSlot)
+}
+
+// LightClientOptimisticUpdateMinMax is the size range of an encoded LightClientOptimisticUpdate of the given fork.
+func LightClientOptimisticUpdateMinMax(spec *common.Spec, fork LightClientFork) reqresp.MinMaxSize {
+	fixed := syncAggregateByteLen(spec) + 8
+	header := lightClientHeaderFieldMinMax(fork)
+	return reqresp.MinMaxSize{Min: fixed + header.Min, Max: fixed + header.Max}
+}
+
+// LightClientFinalityUpdateRPCv1 serves the latest finality update, without request data,
+// with the fork-digest of the update attested header slot as context-bytes.
+func LightClientFinalityUpdateRPCv1(spec *common.Spec, cfg *NetworkConfig, forks LightClientForks) *reqresp.Method {
+	return &reqresp.Method{
+		Protocol:       reqresp.BeaconChainProtocol("light_client_finality_update", 1, reqresp.SnappyCompression{}),
+		RequestMinMax:  reqresp.MinMaxSize{Min: 0, Max: 0}, // no request data, just empty bytes.
+		Compression:    reqresp.SnappyCompression{},
+		MaxPayloadSize: cfg.MAX_PAYLOAD_SIZE,
+		ReadContextBytes: BlocksContext(forks.minMax(func(fork LightClientFork) reqresp.MinMaxSize {
+			return cfg.payloadMinMax(LightClientFinalityUpdateMinMax(spec, fork))
+		})),
+		MaxResponseChunks: reqresp.SingleResponseChunk,
+	}
+}
+
+// LightClientOptimisticUpdateRPCv1 serves the latest optimistic update, without request data,
+// with the fork-digest of the update attested header slot as context-bytes.
+func LightClientOptimisticUpdateRPCv1(spec *common.Spec, cfg *NetworkConfig, forks LightClientForks) *reqresp.Method {
+	return &reqresp.Method{
+		Protocol:       reqresp.BeaconChainProtocol("light_client_optimistic_update", 1, reqresp.SnappyCompression{}),
+		RequestMinMax:  reqresp.MinMaxSize{Min: 0, Max: 0}, // no request data, just empty bytes.
+		Compression:    reqresp.SnappyCompression{},
+		MaxPayloadSize: cfg.MAX_PAYLOAD_SIZE,
+		ReadContextBytes: BlocksContext(forks.minMax(func(fork LightClientFork) reqresp.MinMaxSize {
+			return cfg.payloadMinMax(LightClientOptimisticUpdateMinMax(spec, fork))
+		})),
+		MaxResponseChunks: reqresp.SingleResponseChunk,
+	}
+}
+
+// RequestLightClientFinalityUpdate requests the latest finality update from the peer,
+// and decodes it with the light client layout matching the context-bytes.
+func RequestLightClientFinalityUpdate(ctx context.Context, spec *common.Spec, cfg *NetworkConfig, forks LightClientForks,
+	newStreamFn reqresp.NewStreamFn, peerId peer.ID) (*LightClientFinalityUpdate, error) {
+
+	var update *LightClientFinalityUpdate
+	err := requestLightClientObj(ctx, LightClientFinalityUpdateRPCv1(spec, cfg, forks), spec, forks,
+		newStreamFn, peerId, EmptyReq{}, func(fork LightClientFork) common.SpecObj {
+			update = &LightClientFinalityUpdate{Fork: fork}
+			return update
+		})
+	return update, err
+}
+
+// RequestLightClientOptimisticUpdate requests the latest optimistic update from the peer,
+// and decodes it with the light client layout matching the context-bytes.
+func RequestLightClientOptimisticUpdate(ctx context.Context, spec *common.Spec, cfg *NetworkConfig, forks LightClientForks,
+	newStreamFn reqresp.NewStreamFn, peerId peer.ID) (*LightClientOptimisticUpdate, error) {
+
+	var update *LightClientOptimisticUpdate
+	err := requestLightClientObj(ctx, LightClientOptimisticUpdateRPCv1(spec, cfg, forks), spec, forks,
+		newStreamFn, peerId, EmptyReq{}, func(fork LightClientFork) common.SpecObj {
+			update = &LightClientOptimisticUpdate{Fork: fork}
+			return update
+		})
+	return update, err
+}
+
+type LightClientUpdateProvider interface {
+	// LightClientFinalityUpdate returns the latest finality update, and the fork digest to serve it with.
+	// A nil update is served as unavailable resource.
+	LightClientFinalityUpdate(ctx context.Context) (*LightClientFinalityUpdate, common.ForkDigest, error)
+	// LightClientOptimisticUpdate returns the latest optimistic update, and the fork digest to serve it with.
+	// A nil update is served as unavailable resource.
+	LightClientOptimisticUpdate(ctx context.Context) (*LightClientOptimisticUpdate, common.ForkDigest, error)
+}
+
+// ServeLightClientFinalityUpdate handles light client finality update requests with the given provider.
+func ServeLightClientFinalityUpdate(spec *common.Spec, provider LightClientUpdateProvider) reqresp.OnRequestListener {
+	return func(ctx context.Context, peerId peer.ID, handler reqresp.ChunkedRequestHandler) {
+		update, digest, err := provider.LightClientFinalityUpdate(ctx)
+		if update == nil && err == nil {
+			_ = handler.WriteErrorChunk(reqresp.ResourceUnavailableCode, "no light client finality update available")
+			return
+		}
+		serveLightClientObj(spec, handler, update, digest, err)
+	}
+}
+
+// ServeLightClientOptimisticUpdate handles light client optimistic update requests with the given provider.
+func ServeLightClientOptimisticUpdate(spec *common.Spec, provider LightClientUpdateProvider) reqresp.OnRequestListener {
+	return func(ctx context.Context, peerId peer.ID, handler reqresp.ChunkedRequestHandler) {
+		update, digest, err := provider.LightClientOptimisticUpdate(ctx)
+		if update == nil && err == nil {
+			_ = handler.WriteErrorChunk(reqresp.ResourceUnavailableCode, "no light client optimistic update available")
+			return
+		}
+		serveLightClientObj(spec, handler, update, digest, err)
+	}
+}
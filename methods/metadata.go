@@ -1,13 +1,81 @@
 package methods
 
 import (
+	"context"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/protolambda/go-eth2-reqresp/reqresp"
 	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
 )
 
-var MetaDataRPCv1 = reqresp.Method{
-	Protocol:         "/eth2/beacon_chain/req/metadata/1/ssz_snappy",
-	RequestMinMax:    reqresp.MinMaxSize{0, 0}, // no request data, just empty bytes.
-	Compression:      reqresp.SnappyCompression{},
-	ReadContextBytes: NoContext(reqresp.MinMaxSize{Min: common.MetadataByteLen, Max: common.MetadataByteLen}),
+// MetaDataV1 is the response of the metadata method. The method has no request data.
+type MetaDataV1 common.MetaData
+
+func (m *MetaDataV1) Deserialize(dr *codec.DecodingReader) error {
+	return (*common.MetaData)(m).Deserialize(dr)
+}
+
+func (m *MetaDataV1) Serialize(w *codec.EncodingWriter) error {
+	return (*common.MetaData)(m).Serialize(w)
+}
+
+func (m *MetaDataV1) ByteLength() uint64 {
+	return common.MetadataByteLen
+}
+
+func (*MetaDataV1) FixedLength() uint64 {
+	return common.MetadataByteLen
+}
+
+func (m *MetaDataV1) HashTreeRoot(hFn tree.HashFn) common.Root {
+	return (*common.MetaData)(m).HashTreeRoot(hFn)
+}
+
+func (m *MetaDataV1) String() string {
+	return (*common.MetaData)(m).String()
+}
+
+// MetaDataRPCv1 serves our metadata, without request data.
+func MetaDataRPCv1(cfg *NetworkConfig) *reqresp.Method {
+	return &reqresp.Method{
+		Protocol:          reqresp.BeaconChainProtocol("metadata", 1, reqresp.SnappyCompression{}),
+		RequestMinMax:     reqresp.MinMaxSize{Min: 0, Max: 0}, // no request data, just empty bytes.
+		Compression:       reqresp.SnappyCompression{},
+		MaxPayloadSize:    cfg.MAX_PAYLOAD_SIZE,
+		ReadContextBytes:  NoContext(cfg.payloadMinMax(reqresp.MinMaxSize{Min: common.MetadataByteLen, Max: common.MetadataByteLen})),
+		MaxResponseChunks: reqresp.SingleResponseChunk,
+	}
+}
+
+// RequestMetaData requests the metadata of the peer.
+func RequestMetaData(ctx context.Context, cfg *NetworkConfig, newStreamFn reqresp.NewStreamFn, peerId peer.ID) (*MetaDataV1, error) {
+	var theirs MetaDataV1
+	if err := requestOne(ctx, MetaDataRPCv1(cfg), newStreamFn, peerId, EmptyReq{}, fixedDest(&theirs)); err != nil {
+		return nil, err
+	}
+	return &theirs, nil
+}
+
+type MetaDataProvider interface {
+	// MetaData returns our metadata to respond with.
+	MetaData(ctx context.Context) (*MetaDataV1, error)
+}
+
+// MetaDataStreamHandler builds the stream handler of metadata requests, served by ServeMetaData.
+func MetaDataStreamHandler(newCtx reqresp.StreamCtxFn, cfg *NetworkConfig, provider MetaDataProvider) network.StreamHandler {
+	return MetaDataRPCv1(cfg).MakeStreamHandler(newCtx, ServeMetaData(provider))
+}
+
+// ServeMetaData handles metadata requests with the given provider.
+func ServeMetaData(provider MetaDataProvider) reqresp.OnRequestListener {
+	return func(ctx context.Context, peerId peer.ID, handler reqresp.ChunkedRequestHandler) {
+		ours, err := provider.MetaData(ctx)
+		if err != nil {
+			_ = handler.WriteErrorChunk(reqresp.ServerErrCode, "failed to get metadata")
+			return
+		}
+		_ = handler.StreamSSZ(reqresp.SuccessCode, nil, ours)
+	}
 }
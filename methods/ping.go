@@ -1,12 +1,88 @@
 package methods
 
 import (
+	"context"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/protolambda/go-eth2-reqresp/reqresp"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
+	"github.com/protolambda/ztyp/view"
 )
 
-var PingRPCv1 = reqresp.Method{
-	Protocol:         "/eth2/beacon_chain/req/ping/1/ssz_snappy",
-	RequestMinMax:    reqresp.MinMaxSize{Min: 8, Max: 8},
-	Compression:      reqresp.SnappyCompression{},
-	ReadContextBytes: NoContext(reqresp.MinMaxSize{Min: 8, Max: 8}),
+// PingV1 is both the request and response of the ping method: the metadata sequence number of the sender.
+type PingV1 common.SeqNr
+
+func (p *PingV1) Deserialize(dr *codec.DecodingReader) error {
+	return (*view.Uint64View)(p).Deserialize(dr)
+}
+
+func (p PingV1) Serialize(w *codec.EncodingWriter) error {
+	return w.WriteUint64(uint64(p))
+}
+
+func (PingV1) ByteLength() uint64 {
+	return 8
+}
+
+func (PingV1) FixedLength() uint64 {
+	return 8
+}
+
+func (p PingV1) HashTreeRoot(hFn tree.HashFn) common.Root {
+	return view.Uint64View(p).HashTreeRoot(hFn)
+}
+
+func (p PingV1) String() string {
+	return view.Uint64View(p).String()
+}
+
+// PingRPCv1 exchanges the metadata sequence numbers of the peers, both as request and response.
+func PingRPCv1(cfg *NetworkConfig) *reqresp.Method {
+	minMax := cfg.payloadMinMax(reqresp.MinMaxSize{Min: 8, Max: 8})
+	return &reqresp.Method{
+		Protocol:          reqresp.BeaconChainProtocol("ping", 1, reqresp.SnappyCompression{}),
+		RequestMinMax:     minMax,
+		Compression:       reqresp.SnappyCompression{},
+		MaxPayloadSize:    cfg.MAX_PAYLOAD_SIZE,
+		ReadContextBytes:  NoContext(minMax),
+		MaxResponseChunks: reqresp.SingleResponseChunk,
+	}
+}
+
+// RequestPing sends our metadata sequence number to the peer, and returns the sequence number of the peer.
+func RequestPing(ctx context.Context, cfg *NetworkConfig, newStreamFn reqresp.NewStreamFn, peerId peer.ID, ours PingV1) (PingV1, error) {
+	var theirs PingV1
+	if err := requestOne(ctx, PingRPCv1(cfg), newStreamFn, peerId, ours, fixedDest(&theirs)); err != nil {
+		return 0, err
+	}
+	return theirs, nil
+}
+
+type PingProvider interface {
+	// Ping receives the metadata sequence number of the peer, and returns our sequence number to respond with.
+	Ping(ctx context.Context, peerId peer.ID, theirs PingV1) (ours PingV1, err error)
+}
+
+// PingStreamHandler builds the stream handler of ping requests, served by ServePing.
+func PingStreamHandler(newCtx reqresp.StreamCtxFn, cfg *NetworkConfig, provider PingProvider) network.StreamHandler {
+	return PingRPCv1(cfg).MakeStreamHandler(newCtx, ServePing(provider))
+}
+
+// ServePing handles ping requests with the given provider.
+func ServePing(provider PingProvider) reqresp.OnRequestListener {
+	return func(ctx context.Context, peerId peer.ID, handler reqresp.ChunkedRequestHandler) {
+		var theirs PingV1
+		if err := handler.ReadRequest(&theirs); err != nil {
+			_ = handler.WriteErrorChunk(reqresp.InvalidReqCode, "could not parse ping request")
+			return
+		}
+		ours, err := provider.Ping(ctx, peerId, theirs)
+		if err != nil {
+			_ = handler.WriteErrorChunk(reqresp.ServerErrCode, "failed to get metadata sequence number")
+			return
+		}
+		_ = handler.StreamSSZ(reqresp.SuccessCode, nil, ours)
+	}
 }
@@ -1,13 +1,87 @@
 package methods
 
 import (
+	"context"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/protolambda/go-eth2-reqresp/reqresp"
 	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
 )
 
-var StatusRPCv1 = reqresp.Method{
-	Protocol:         "/eth2/beacon_chain/req/status/1/ssz_snappy",
-	RequestMinMax:    reqresp.MinMaxSize{Min: common.StatusByteLen, Max: common.StatusByteLen},
-	Compression:      reqresp.SnappyCompression{},
-	ReadContextBytes: NoContext(reqresp.MinMaxSize{Min: common.StatusByteLen, Max: common.StatusByteLen}),
+// StatusV1 is both the request and response of the status method.
+type StatusV1 common.Status
+
+func (s *StatusV1) Deserialize(dr *codec.DecodingReader) error {
+	return (*common.Status)(s).Deserialize(dr)
+}
+
+func (s *StatusV1) Serialize(w *codec.EncodingWriter) error {
+	return (*common.Status)(s).Serialize(w)
+}
+
+func (s *StatusV1) ByteLength() uint64 {
+	return common.StatusByteLen
+}
+
+func (*StatusV1) FixedLength() uint64 {
+	return common.StatusByteLen
+}
+
+func (s *StatusV1) HashTreeRoot(hFn tree.HashFn) common.Root {
+	return (*common.Status)(s).HashTreeRoot(hFn)
+}
+
+func (s *StatusV1) String() string {
+	return (*common.Status)(s).String()
+}
+
+// StatusRPCv1 exchanges the status of the peers, both as request and response.
+func StatusRPCv1(cfg *NetworkConfig) *reqresp.Method {
+	minMax := cfg.payloadMinMax(reqresp.MinMaxSize{Min: common.StatusByteLen, Max: common.StatusByteLen})
+	return &reqresp.Method{
+		Protocol:          reqresp.BeaconChainProtocol("status", 1, reqresp.SnappyCompression{}),
+		RequestMinMax:     minMax,
+		Compression:       reqresp.SnappyCompression{},
+		MaxPayloadSize:    cfg.MAX_PAYLOAD_SIZE,
+		ReadContextBytes:  NoContext(minMax),
+		MaxResponseChunks: reqresp.SingleResponseChunk,
+	}
+}
+
+// RequestStatus sends our status to the peer, and returns the status the peer responded with.
+func RequestStatus(ctx context.Context, cfg *NetworkConfig, newStreamFn reqresp.NewStreamFn, peerId peer.ID, ours *StatusV1) (*StatusV1, error) {
+	var theirs StatusV1
+	if err := requestOne(ctx, StatusRPCv1(cfg), newStreamFn, peerId, ours, fixedDest(&theirs)); err != nil {
+		return nil, err
+	}
+	return &theirs, nil
+}
+
+type StatusProvider interface {
+	// Status receives the status of the peer, and returns our status to respond with.
+	Status(ctx context.Context, peerId peer.ID, theirs *StatusV1) (ours *StatusV1, err error)
+}
+
+// StatusStreamHandler builds the stream handler of status requests, served by ServeStatus.
+func StatusStreamHandler(newCtx reqresp.StreamCtxFn, cfg *NetworkConfig, provider StatusProvider) network.StreamHandler {
+	return StatusRPCv1(cfg).MakeStreamHandler(newCtx, ServeStatus(provider))
+}
+
+// ServeStatus handles status requests with the given provider.
+func ServeStatus(provider StatusProvider) reqresp.OnRequestListener {
+	return func(ctx context.Context, peerId peer.ID, handler reqresp.ChunkedRequestHandler) {
+		var theirs StatusV1
+		if err := handler.ReadRequest(&theirs); err != nil {
+			_ = handler.WriteErrorChunk(reqresp.InvalidReqCode, "could not parse status request")
+			return
+		}
+		ours, err := provider.Status(ctx, peerId, &theirs)
+		if err != nil {
+			_ = handler.WriteErrorChunk(reqresp.ServerErrCode, "failed to get status")
+			return
+		}
+		_ = handler.StreamSSZ(reqresp.SuccessCode, nil, ours)
+	}
 }
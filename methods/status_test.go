@@ -0,0 +1,99 @@
+package methods
+
+import (
+	"context"
+	"errors"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/protolambda/go-eth2-reqresp/reqresp"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type testStatusProvider struct {
+	status   StatusV1
+	metaData MetaDataV1
+	goodbyes chan GoodbyeReason
+	err      error
+}
+
+func (p *testStatusProvider) Status(ctx context.Context, peerId peer.ID, theirs *StatusV1) (*StatusV1, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &p.status, nil
+}
+
+func (p *testStatusProvider) Ping(ctx context.Context, peerId peer.ID, theirs PingV1) (PingV1, error) {
+	if p.err != nil {
+		return 0, p.err
+	}
+	return PingV1(p.metaData.SeqNumber), nil
+}
+
+func (p *testStatusProvider) Goodbye(ctx context.Context, peerId peer.ID, reason GoodbyeReason) {
+	p.goodbyes <- reason
+}
+
+func (p *testStatusProvider) MetaData(ctx context.Context) (*MetaDataV1, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &p.metaData, nil
+}
+
+func TestStatusPingGoodbyeMetaData(t *testing.T) {
+	assert := assert.New(t)
+
+	provider := &testStatusProvider{
+		status:   StatusV1{ForkDigest: altairDigest, HeadRoot: common.Root{1}, HeadSlot: 123},
+		metaData: MetaDataV1{SeqNumber: 42},
+		goodbyes: make(chan GoodbyeReason, 1),
+	}
+	provider.metaData.Attnets[0] = 0xff
+
+	cfg := MainnetNetworkConfig()
+	serve := func(provider *testStatusProvider) (server host.Host, client host.Host) {
+		server, client = testPeers(t)
+		server.SetStreamHandler(StatusRPCv1(cfg).Protocol, StatusStreamHandler(context.Background, cfg, provider))
+		server.SetStreamHandler(PingRPCv1(cfg).Protocol, PingStreamHandler(context.Background, cfg, provider))
+		server.SetStreamHandler(GoodbyeRPCv1(cfg).Protocol, GoodbyeStreamHandler(context.Background, cfg, provider))
+		server.SetStreamHandler(MetaDataRPCv1(cfg).Protocol, MetaDataStreamHandler(context.Background, cfg, provider))
+		return server, client
+	}
+	server, client := serve(provider)
+
+	ctx := context.Background()
+	status, err := RequestStatus(ctx, cfg, client.NewStream, server.ID(), &StatusV1{HeadSlot: 10})
+	assert.NoError(err)
+	assert.Equal(&provider.status, status)
+
+	seq, err := RequestPing(ctx, cfg, client.NewStream, server.ID(), 1)
+	assert.NoError(err)
+	assert.Equal(PingV1(42), seq)
+
+	metaData, err := RequestMetaData(ctx, cfg, client.NewStream, server.ID())
+	assert.NoError(err)
+	assert.Equal(&provider.metaData, metaData)
+
+	assert.NoError(RequestGoodbye(ctx, cfg, client.NewStream, server.ID(), GoodbyeFaultError))
+	assert.Equal(GoodbyeFaultError, <-provider.goodbyes)
+
+	// provider errors are not exposed to the peer
+	server, client = serve(&testStatusProvider{err: errors.New("internal details")})
+	expectServerErr := func(err error) {
+		t.Helper()
+		var errResp *reqresp.ErrorResponse
+		if assert.ErrorAs(err, &errResp) {
+			assert.Equal(reqresp.ServerErrCode, errResp.Code)
+			assert.NotContains(errResp.Msg, "internal details")
+		}
+	}
+	_, err = RequestStatus(ctx, cfg, client.NewStream, server.ID(), &StatusV1{HeadSlot: 10})
+	expectServerErr(err)
+	_, err = RequestPing(ctx, cfg, client.NewStream, server.ID(), 1)
+	expectServerErr(err)
+	_, err = RequestMetaData(ctx, cfg, client.NewStream, server.ID())
+	expectServerErr(err)
+}
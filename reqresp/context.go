@@ -0,0 +1,53 @@
+package reqresp
+
+import (
+	"fmt"
+	"github.com/protolambda/ztyp/codec"
+	"io"
+)
+
+// ContextType is the size range and type of response chunks with specific <context-bytes>.
+type ContextType struct {
+	MinMax MinMaxSize
+	// New creates the object to decode a response chunk into. Optional, only used by ContextLookup.ReadObj.
+	New func() codec.Deserializable
+}
+
+// ContextLookup resolves the <context-bytes> of a response chunk to its type.
+type ContextLookup func(contextBytes []byte) (ContextType, error)
+
+// ReadContext builds a ReadContextFn that reads <context-bytes> of the given length (possibly 0),
+// and determines the chunk size range with the lookup.
+func ReadContext(contextLen uint64, lookup ContextLookup) ReadContextFn {
+	return func(blr *BufLimitReader) (contextBytes []byte, minMax MinMaxSize, err error) {
+		if contextLen > 0 {
+			blr.N = int(contextLen)
+			blr.PerRead = false
+			contextBytes = make([]byte, contextLen)
+			if _, err := io.ReadFull(blr, contextBytes); err != nil {
+				return nil, MinMaxSize{}, err
+			}
+		}
+		typ, err := lookup(contextBytes)
+		if err != nil {
+			return nil, MinMaxSize{}, err
+		}
+		return contextBytes, typ.MinMax, nil
+	}
+}
+
+// ReadObj resolves the type of a response chunk by its <context-bytes>, to decode it with ChunkedResponseHandler.ReadObj.
+// The new object is stored in dest.
+func (lookup ContextLookup) ReadObj(dest *codec.Deserializable) func(contextBytes []byte) (codec.Deserializable, error) {
+	return func(contextBytes []byte) (codec.Deserializable, error) {
+		typ, err := lookup(contextBytes)
+		if err != nil {
+			return nil, err
+		}
+		if typ.New == nil {
+			return nil, fmt.Errorf("no type to decode context-bytes 0x%x", contextBytes)
+		}
+		*dest = typ.New()
+		return *dest, nil
+	}
+}
@@ -0,0 +1,54 @@
+package reqresp
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestReadContext(t *testing.T) {
+	lookup := ContextLookup(func(contextBytes []byte) (ContextType, error) {
+		if bytes.Equal(contextBytes, []byte{1, 2}) {
+			return ContextType{MinMax: MinMaxSize{Min: 10, Max: 20}}, nil
+		}
+		return ContextType{}, fmt.Errorf("unknown context-bytes %x", contextBytes)
+	})
+	readContext := ReadContext(2, lookup)
+
+	blr := NewBufLimitReader(bytes.NewReader([]byte{1, 2, 3}), 1024, 0)
+	contextBytes, minMax, err := readContext(blr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(contextBytes, []byte{1, 2}) {
+		t.Errorf("unexpected context-bytes %x", contextBytes)
+	}
+	if minMax != (MinMaxSize{Min: 10, Max: 20}) {
+		t.Errorf("unexpected size range %v", minMax)
+	}
+	if b, err := blr.ReadByte(); err == nil || b == 3 {
+		t.Error("context reader must not read past the context-bytes")
+	}
+
+	blr = NewBufLimitReader(bytes.NewReader([]byte{2, 1}), 1024, 0)
+	if _, _, err := readContext(blr); err == nil {
+		t.Error("expected lookup error")
+	}
+	blr = NewBufLimitReader(bytes.NewReader([]byte{1}), 1024, 0)
+	if _, _, err := readContext(blr); err == nil {
+		t.Error("expected error on missing context-bytes")
+	}
+}
+
+func TestReadContextEmpty(t *testing.T) {
+	var got []byte
+	readContext := ReadContext(0, func(contextBytes []byte) (ContextType, error) {
+		got = contextBytes
+		return ContextType{MinMax: MinMaxSize{Min: 1, Max: 1}}, nil
+	})
+	blr := NewBufLimitReader(bytes.NewReader([]byte{0xff}), 1024, 0)
+	contextBytes, minMax, err := readContext(blr)
+	if err != nil || contextBytes != nil || got != nil || minMax.Max != 1 {
+		t.Errorf("unexpected result: %x %v %v", contextBytes, minMax, err)
+	}
+}
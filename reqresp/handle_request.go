@@ -19,7 +19,13 @@ type RequestPayloadHandler func(ctx context.Context, peerId peer.ID, requestLen
 type StreamCtxFn func() context.Context
 
 // startReqRPC registers a request handler for the given protocol. Compression is optional and may be nil.
+// Requests may not exceed DEFAULT_MAX_PAYLOAD_SIZE.
 func (handle RequestPayloadHandler) MakeStreamHandler(newCtx StreamCtxFn, comp Compression, minRequestContentSize, maxRequestContentSize uint64) network.StreamHandler {
+	return handle.makeStreamHandler(newCtx, comp, minRequestContentSize, maxRequestContentSize, DEFAULT_MAX_PAYLOAD_SIZE)
+}
+
+func (handle RequestPayloadHandler) makeStreamHandler(newCtx StreamCtxFn, comp Compression,
+	minRequestContentSize, maxRequestContentSize uint64, maxPayloadSize uint64) network.StreamHandler {
 	return func(stream network.Stream) {
 		peerId := stream.Conn().RemotePeer()
 		ctx, cancel := context.WithCancel(newCtx())
@@ -44,35 +50,26 @@ func (handle RequestPayloadHandler) MakeStreamHandler(newCtx StreamCtxFn, comp C
 		blr.PerRead = false
 		if err != nil {
 			invalidInputErr = err
+		} else if err := checkPayloadSize(reqLen, maxPayloadSize); err != nil {
+			invalidInputErr = err
 		} else if reqLen < minRequestContentSize {
 			// Check against raw content size minimum (without compression applied)
 			invalidInputErr = fmt.Errorf("request length %d is unexpectedly small, request size minimum is %d", reqLen, minRequestContentSize)
 		} else if reqLen > maxRequestContentSize {
 			// Check against raw content size limit (without compression applied)
 			invalidInputErr = fmt.Errorf("request length %d exceeds request size limit %d", reqLen, maxRequestContentSize)
-		} else if comp != nil {
-			// Now apply compression adjustment for size limit, and use that as the limit for the buffered-limited-reader.
-			s, err := comp.MaxEncodedLen(maxRequestContentSize)
-			if err != nil {
-				invalidInputErr = err
-			} else {
-				maxRequestContentSize = s
-			}
+		}
+		// Now apply compression adjustment for the size limit, and use that as the limit for the buffered-limited-reader.
+		// The request is never larger than its stated length, even if the method bounds are looser.
+		readLimit, err := maxPayloadReadLen(reqLen, comp)
+		if err != nil && invalidInputErr == nil {
+			invalidInputErr = err
 		}
 		// If the input is invalid, never read it.
 		if invalidInputErr != nil {
-			maxRequestContentSize = 0
-		}
-		if comp == nil {
-			blr.N = int(maxRequestContentSize)
-		} else {
-			v, err := comp.MaxEncodedLen(maxRequestContentSize)
-			if err != nil {
-				blr.N = int(maxRequestContentSize)
-			} else {
-				blr.N = int(v)
-			}
+			readLimit = 0
 		}
+		blr.N = int(readLimit)
 		// allow the consumer of the request to close the read-side of the stream
 		r := readAndCloseFn{Reader: blr, close: stream.CloseRead}
 		handle(ctx, peerId, reqLen, r, w, comp, invalidInputErr)
@@ -20,82 +20,143 @@ type ResponseHandler func(ctx context.Context, r io.ReadCloser) error
 // The blr.N and blr.PerRead fields should be customized to read the input.
 type ReadContextFn func(blr *BufLimitReader) (contextBytes []byte, minMax MinMaxSize, err error)
 
+// chunkReader parses the response chunks of a response stream one by one.
+type chunkReader struct {
+	blr           *BufLimitReader
+	maxChunkCount uint64
+	readContext   ReadContextFn
+	comp          Compression
+	// max uncompressed size of any chunk
+	maxPayloadSize uint64
+	chunkIndex     uint64
+	// contents of the previous chunk, the unread remainder is skipped before reading the next chunk.
+	prev *io.LimitedReader
+}
+
+func newChunkReader(r io.Reader, maxChunkCount uint64, readContext ReadContextFn, comp Compression, maxPayloadSize uint64) *chunkReader {
+	return &chunkReader{
+		blr:            NewBufLimitReader(r, 1024, 0),
+		maxChunkCount:  maxChunkCount,
+		readContext:    readContext,
+		comp:           comp,
+		maxPayloadSize: maxPayloadSize,
+	}
+}
+
+// next parses the next chunk up to its contents, which can be read (decompressed) from the returned chunk.
+// It returns io.EOF if there are no chunks left, or if maxChunkCount chunks were read already.
+func (c *chunkReader) next() (*chRespHandler, error) {
+	//		response  ::= <response_chunk>*
+	//      response_chunk  ::= <result> | <context-bytes> | <encoding-dependent-header> | <encoded-payload>
+	//		result    ::= “0” | “1” | “2” | [“128” ... ”255”]
+	//
+	// note: a phase0 type of req-resp method may simply read 0 <context-bytes>.
+	if c.chunkIndex >= c.maxChunkCount {
+		return nil, io.EOF
+	}
+	chunkIndex := c.chunkIndex
+	if c.prev != nil {
+		if _, err := io.Copy(io.Discard, c.prev); err != nil {
+			return nil, fmt.Errorf("failed to skip remainder of chunk %d: %v", chunkIndex-1, err)
+		}
+		c.prev = nil
+	}
+	blr := c.blr
+	blr.N = 1
+	resByte, err := blr.ReadByte()
+	if err == io.EOF { // no more chunks left.
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chunk %d result byte: %v", chunkIndex, err)
+	}
+	var contextBytes []byte
+	var minMax MinMaxSize
+	if ResponseCode(resByte) == SuccessCode {
+		// read the <context-bytes>, if any.
+		if c.readContext != nil {
+			contextBytes, minMax, err = c.readContext(blr)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read context-bytes: %v", err)
+			}
+		}
+	}
+	// varints need to be read byte by byte.
+	blr.N = 1
+	blr.PerRead = true
+	chunkSize, err := binary.ReadUvarint(blr)
+	blr.PerRead = false
+	// TODO when input is incorrect, return a different type of error.
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chunk size: %v", err)
+	}
+	if err := checkPayloadSize(chunkSize, c.maxPayloadSize); err != nil {
+		return nil, fmt.Errorf("chunk %d: %v", chunkIndex, err)
+	}
+	chunkMax := chunkSize
+	if ResponseCode(resByte) == SuccessCode {
+		if chunkSize < minMax.Min {
+			return nil, fmt.Errorf("chunk size %d of chunk %d lower than chunk min %d", chunkSize, chunkIndex, minMax.Min)
+		}
+		if chunkSize > minMax.Max {
+			return nil, fmt.Errorf("chunk size %d of chunk %d higher than chunk max %d", chunkSize, chunkIndex, minMax.Max)
+		}
+	} else {
+		if chunkSize > MAX_ERR_SIZE {
+			return nil, fmt.Errorf("chunk size %d of chunk %d exceeds error size limit %d", chunkSize, chunkIndex, MAX_ERR_SIZE)
+		}
+		chunkMax = MAX_ERR_SIZE
+	}
+	chunkMax, err = maxPayloadReadLen(chunkMax, c.comp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute max compressed length: %v", err)
+	}
+	blr.N = int(chunkMax)
+	cr := io.Reader(blr)
+	if c.comp != nil {
+		cr = c.comp.Decompress(cr)
+	}
+	c.prev = &io.LimitedReader{R: cr, N: int64(chunkSize)}
+	c.chunkIndex++
+	return &chRespHandler{
+		r:            c.prev,
+		result:       ResponseCode(resByte),
+		chunkSize:    chunkSize,
+		chunkIndex:   chunkIndex,
+		contextBytes: contextBytes,
+	}, nil
+}
+
 // MakeResponseHandler builds a ResponseHandler, which won't take more than maxChunkCount chunks, or chunk contents larger than maxChunkContentSize.
 // Compression is optional and may be nil. Chunks are processed by the given ResponseChunkHandler.
+// Chunks may not exceed DEFAULT_MAX_PAYLOAD_SIZE.
 func (handleChunk ResponseChunkHandler) MakeResponseHandler(
 	maxChunkCount uint64,
 	readContext ReadContextFn,
 	comp Compression) ResponseHandler {
-	//		response  ::= <response_chunk>*
-	//      response_chunk  ::= <result> | <context-bytes> | <encoding-dependent-header> | <encoded-payload>
-	//		result    ::= “0” | “1” | “2” | [“128” ... ”255”]
-	//
-	// note: a phase0 type of req-resp method may simply read 0 <context-bytes>.
+	return handleChunk.makeResponseHandler(maxChunkCount, readContext, comp, DEFAULT_MAX_PAYLOAD_SIZE)
+}
+
+func (handleChunk ResponseChunkHandler) makeResponseHandler(
+	maxChunkCount uint64,
+	readContext ReadContextFn,
+	comp Compression,
+	maxPayloadSize uint64) ResponseHandler {
 	return func(ctx context.Context, r io.ReadCloser) error {
 		// Stop reading chunks as soon as we exit.
 		defer r.Close()
-		if maxChunkCount == 0 {
-			return nil
-		}
-		blr := NewBufLimitReader(r, 1024, 0)
-		for chunkIndex := uint64(0); chunkIndex < maxChunkCount; chunkIndex++ {
-			blr.N = 1
-			resByte, err := blr.ReadByte()
-			if err == io.EOF { // no more chunks left.
+		chunks := newChunkReader(r, maxChunkCount, readContext, comp, maxPayloadSize)
+		for {
+			chunk, err := chunks.next()
+			if err == io.EOF {
 				return nil
 			}
 			if err != nil {
-				return fmt.Errorf("failed to read chunk %d result byte: %v", chunkIndex, err)
-			}
-			var contextBytes []byte
-			var minMax MinMaxSize
-			if ResponseCode(resByte) == SuccessCode {
-				// read the <context-bytes>, if any.
-				if readContext != nil {
-					contextBytes, minMax, err = readContext(blr)
-					if err != nil {
-						return fmt.Errorf("failed to read context-bytes: %v", err)
-					}
-				}
-			}
-			// varints need to be read byte by byte.
-			blr.N = 1
-			blr.PerRead = true
-			chunkSize, err := binary.ReadUvarint(blr)
-			blr.PerRead = false
-			// TODO when input is incorrect, return a different type of error.
-			if err != nil {
-				return fmt.Errorf("failed to read chunk size: %v", err)
-			}
-			chunkMax := chunkSize
-			if ResponseCode(resByte) == SuccessCode {
-				if chunkSize < minMax.Min {
-					return fmt.Errorf("chunk size %d of chunk %d lower than chunk min %d", chunkSize, chunkIndex, minMax.Min)
-				}
-				if chunkSize > minMax.Max {
-					return fmt.Errorf("chunk size %d of chunk %d higher than chunk max %d", chunkSize, chunkIndex, minMax.Max)
-				}
-			} else {
-				if chunkSize > MAX_ERR_SIZE {
-					return fmt.Errorf("chunk size %d of chunk %d exceeds error size limit %d", chunkSize, chunkIndex, MAX_ERR_SIZE)
-				}
-				chunkMax = MAX_ERR_SIZE
-			}
-			if comp != nil {
-				chunkMax, err = comp.MaxEncodedLen(chunkMax)
-				if err != nil {
-					return fmt.Errorf("failed to compute max compressed length: %v", err)
-				}
-			}
-			blr.N = int(chunkMax)
-			cr := io.Reader(blr)
-			if comp != nil {
-				cr = comp.Decompress(cr)
+				return err
 			}
-			if err := handleChunk(ctx, chunkIndex, chunkSize, ResponseCode(resByte), contextBytes, cr); err != nil {
+			if err := handleChunk(ctx, chunk.chunkIndex, chunk.chunkSize, chunk.result, chunk.contextBytes, chunk.r); err != nil {
 				return err
 			}
 		}
-		return nil
 	}
 }
@@ -38,19 +38,98 @@ type Method struct {
 	ReadContextBytes ReadContextFn
 	// Compression to apply to requests and response chunks. Nil if no compression.
 	Compression Compression
+	// MaxResponseChunks computes the max number of response chunks from the request. Optional.
+	// If set, it caps the response chunks read by requests, and responders do not write more chunks than it allows.
+	MaxResponseChunks MaxResponseChunksFn
+	// ClientMiddleware wraps RunRequest of the method, the first is the outermost. Optional.
+	ClientMiddleware []ClientMiddleware
+	// ServerMiddleware wraps the listeners of the stream handlers of the method, the first is the outermost. Optional.
+	ServerMiddleware []ServerMiddleware
+	// MaxPayloadSize is the max uncompressed size of any request or response chunk, regardless of the size bounds.
+	// Zero defaults to DEFAULT_MAX_PAYLOAD_SIZE.
+	MaxPayloadSize uint64
+}
+
+// MaxResponseChunksFn computes the max number of response chunks allowed for the request.
+// On the client side the request is passed as given to the request, on the server side as decoded by the responder.
+// Servers of methods without request data pass a nil request.
+// The limit applies to success chunks: a responder may always end the response with a single error chunk.
+type MaxResponseChunksFn func(req codec.Serializable) (uint64, error)
+
+// SingleResponseChunk is the MaxResponseChunksFn of methods that respond with a single chunk.
+func SingleResponseChunk(req codec.Serializable) (uint64, error) {
+	return 1, nil
+}
+
+// MethodResponseChunks can be passed as max number of response chunks to a request,
+// to only be limited by the MaxResponseChunks of the method.
+const MethodResponseChunks = ^uint64(0)
+
+// responseChunks caps the max number of response chunks of the request with the limit of the method, if any.
+func (m *Method) responseChunks(req codec.Serializable, maxRespChunks uint64) (uint64, error) {
+	if m.MaxResponseChunks == nil {
+		return maxRespChunks, nil
+	}
+	n, err := m.MaxResponseChunks(req)
+	if err != nil {
+		return 0, fmt.Errorf("bad request: %v", err)
+	}
+	if n < maxRespChunks {
+		return n, nil
+	}
+	return maxRespChunks, nil
 }
 
 type ResponseCode uint8
 
 const (
-	SuccessCode    ResponseCode = 0
-	InvalidReqCode ResponseCode = 1
-	ServerErrCode  ResponseCode = 2
+	SuccessCode             ResponseCode = 0
+	InvalidReqCode          ResponseCode = 1
+	ServerErrCode           ResponseCode = 2
+	ResourceUnavailableCode ResponseCode = 3
 )
 
+// ErrorResponse is a response chunk with a non-success result code, and the error message it carried.
+type ErrorResponse struct {
+	Code ResponseCode
+	Msg  string
+}
+
+func (e *ErrorResponse) Error() string {
+	return fmt.Sprintf("error response (code %d): %q", e.Code, e.Msg)
+}
+
 // 256 bytes max error size
 const MAX_ERR_SIZE = 256
 
+// DEFAULT_MAX_PAYLOAD_SIZE is the MAX_PAYLOAD_SIZE of mainnet: 10 MiB.
+const DEFAULT_MAX_PAYLOAD_SIZE = 10 * 1024 * 1024
+
+// maxPayloadSize is the MaxPayloadSize of the method, or the default if not set.
+func (m *Method) maxPayloadSize() uint64 {
+	if m.MaxPayloadSize == 0 {
+		return DEFAULT_MAX_PAYLOAD_SIZE
+	}
+	return m.MaxPayloadSize
+}
+
+// checkPayloadSize errors if the uncompressed size exceeds the max payload size.
+func checkPayloadSize(size uint64, maxPayloadSize uint64) error {
+	if size > maxPayloadSize {
+		return fmt.Errorf("payload size %d exceeds max payload size %d", size, maxPayloadSize)
+	}
+	return nil
+}
+
+// maxPayloadReadLen is the max number of bytes to read for a payload of the given uncompressed size,
+// i.e. the max compressed size if there is compression. Compression is optional and may be nil.
+func maxPayloadReadLen(size uint64, comp Compression) (uint64, error) {
+	if comp == nil {
+		return size, nil
+	}
+	return comp.MaxEncodedLen(size)
+}
+
 type OnResponseListener func(chunk ChunkedResponseHandler) error
 
 type ChunkedResponseHandler interface {
@@ -60,6 +139,7 @@ type ChunkedResponseHandler interface {
 	ContextBytes() []byte
 	ReadRaw() ([]byte, error)
 	ReadErrMsg() (string, error)
+	ReadErr() error
 	ReadObj(makeDest func(contextBytes []byte) (dest codec.Deserializable, err error)) error
 }
 
@@ -101,6 +181,15 @@ func (c *chRespHandler) ReadErrMsg() (string, error) {
 	return string(buf.Bytes()), err
 }
 
+// ReadErr reads the error message of a non-success chunk, and returns it as *ErrorResponse.
+func (c *chRespHandler) ReadErr() error {
+	msg, err := c.ReadErrMsg()
+	if err != nil {
+		return fmt.Errorf("failed to read error message of response chunk %d (code %d): %v", c.chunkIndex, c.result, err)
+	}
+	return &ErrorResponse{Code: c.result, Msg: msg}
+}
+
 func (c *chRespHandler) ReadObj(makeDest func(contextBytes []byte) (dest codec.Deserializable, err error)) error {
 	dest, err := makeDest(c.contextBytes)
 	if err != nil {
@@ -115,9 +204,34 @@ func (fn writerToFn) WriteTo(w io.Writer) (n int64, err error) {
 	return fn(w)
 }
 
-func (m *Method) RunRequest(ctx context.Context, newStreamFn NewStreamFn,
-	peerId peer.ID, req codec.Serializable, maxRespChunks uint64, onResponse OnResponseListener) error {
+// requestPayload checks the size of the request, and prepares to write it.
+// The returned writer is nil if the method has no request data.
+func (m *Method) requestPayload(req codec.Serializable) (reqSize uint64, reqTo io.WriterTo, err error) {
+	reqSize = req.ByteLength()
+	if err := m.RequestMinMax.Check(reqSize); err != nil {
+		return 0, nil, fmt.Errorf("bad request: %v", err)
+	}
+	if err := checkPayloadSize(reqSize, m.maxPayloadSize()); err != nil {
+		return 0, nil, fmt.Errorf("bad request: %v", err)
+	}
+	// Methods without request data do not write anything, not even a size header.
+	if m.RequestMinMax.Max > 0 {
+		reqTo = writerToFn(func(w io.Writer) (n int64, err error) {
+			// pick a buffer size based on the
+			size := 1024
+			if size > int(reqSize) {
+				size = int(reqSize)
+			}
+			bw := bufio.NewWriterSize(w, size)
+			defer bw.Flush()
+			return int64(reqSize), req.Serialize(codec.NewEncodingWriter(bw))
+		})
+	}
+	return reqSize, reqTo, nil
+}
 
+// responseHandler builds a ResponseHandler that reads up to maxRespChunks chunks, and processes them with onResponse.
+func (m *Method) responseHandler(maxRespChunks uint64, onResponse OnResponseListener) ResponseHandler {
 	handleChunks := ResponseChunkHandler(func(ctx context.Context, chunkIndex uint64, chunkSize uint64, result ResponseCode, contextBytes []byte, r io.Reader) error {
 		return onResponse(&chRespHandler{
 			m:            m,
@@ -128,25 +242,37 @@ func (m *Method) RunRequest(ctx context.Context, newStreamFn NewStreamFn,
 			contextBytes: contextBytes,
 		})
 	})
+	return handleChunks.makeResponseHandler(maxRespChunks, m.ReadContextBytes, m.Compression, m.maxPayloadSize())
+}
 
-	reqSize := req.ByteLength()
-	if err := m.RequestMinMax.Check(reqSize); err != nil {
-		return fmt.Errorf("bad request: %v", err)
+// RunRequest sends the request to the peer, and processes up to maxRespChunks response chunks with onResponse.
+// The method may limit the number of chunks further, see Method.MaxResponseChunks.
+// The request runs through the ClientMiddleware of the method, if any.
+func (m *Method) RunRequest(ctx context.Context, newStreamFn NewStreamFn,
+	peerId peer.ID, req codec.Serializable, maxRespChunks uint64, onResponse OnResponseListener) error {
+
+	run := RequestFn(m.runRequest)
+	if len(m.ClientMiddleware) > 0 {
+		run = ChainClient(m.ClientMiddleware...)(m, run)
+	}
+	return run(ctx, newStreamFn, peerId, req, maxRespChunks, onResponse)
+}
+
+func (m *Method) runRequest(ctx context.Context, newStreamFn NewStreamFn,
+	peerId peer.ID, req codec.Serializable, maxRespChunks uint64, onResponse OnResponseListener) error {
+
+	reqSize, reqTo, err := m.requestPayload(req)
+	if err != nil {
+		return err
+	}
+	maxRespChunks, err = m.responseChunks(req, maxRespChunks)
+	if err != nil {
+		return err
 	}
-	reqTo := writerToFn(func(w io.Writer) (n int64, err error) {
-		// pick a buffer size based on the
-		size := 1024
-		if size > int(reqSize) {
-			size = int(reqSize)
-		}
-		bw := bufio.NewWriterSize(w, size)
-		defer bw.Flush()
-		return int64(reqSize), req.Serialize(codec.NewEncodingWriter(bw))
-	})
 
 	protocolId := m.Protocol
 
-	respHandler := handleChunks.MakeResponseHandler(maxRespChunks, m.ReadContextBytes, m.Compression)
+	respHandler := m.responseHandler(maxRespChunks, onResponse)
 
 	// Runs the request in sync, which processes responses,
 	// and then finally closes the channel through the earlier deferred close.
@@ -183,6 +309,13 @@ type chReqHandler struct {
 	r               io.ReadCloser
 	w               io.Writer
 	invalidInputErr error
+	// if the number of response chunks is limited, by the MaxResponseChunks of the method.
+	limited   bool
+	maxChunks uint64
+	// the number of success chunks written
+	chunks uint64
+	// if an error chunk was written, which ends the response.
+	ended bool
 }
 
 func (h *chReqHandler) InvalidInput() error {
@@ -190,6 +323,9 @@ func (h *chReqHandler) InvalidInput() error {
 }
 
 func (h *chReqHandler) ReadRequest(dest codec.Deserializable) error {
+	if h.r == nil {
+		return fmt.Errorf("method %s has no request data to read", h.m.Protocol)
+	}
 	defer h.r.Close()
 	if h.invalidInputErr != nil {
 		return h.invalidInputErr
@@ -198,10 +334,53 @@ func (h *chReqHandler) ReadRequest(dest codec.Deserializable) error {
 	if h.m.Compression != nil {
 		r = h.m.Compression.Decompress(r)
 	}
-	return dest.Deserialize(codec.NewDecodingReader(r, h.reqLen))
+	if err := dest.Deserialize(codec.NewDecodingReader(r, h.reqLen)); err != nil {
+		return err
+	}
+	if req, ok := dest.(codec.Serializable); ok {
+		return h.limitChunks(req)
+	}
+	return nil
+}
+
+// limitChunks limits the number of response chunks to what the MaxResponseChunks of the method allows for the request.
+func (h *chReqHandler) limitChunks(req codec.Serializable) error {
+	if h.m.MaxResponseChunks == nil {
+		return nil
+	}
+	n, err := h.m.MaxResponseChunks(req)
+	if err != nil {
+		return fmt.Errorf("failed to determine max response chunks: %v", err)
+	}
+	h.limited = true
+	h.maxChunks = n
+	return nil
+}
+
+// nextChunk counts the next response chunk of the given size, and errors if the request does not allow it.
+// Only success chunks count towards the limit: a single error chunk may always be written, and ends the response.
+func (h *chReqHandler) nextChunk(code ResponseCode, size uint64) error {
+	if err := checkPayloadSize(size, h.m.maxPayloadSize()); err != nil {
+		return err
+	}
+	if h.ended {
+		return fmt.Errorf("cannot write response chunk, response already ended with an error chunk")
+	}
+	if code != SuccessCode {
+		h.ended = true
+		return nil
+	}
+	if h.limited && h.chunks >= h.maxChunks {
+		return fmt.Errorf("cannot write response chunk %d, request allows max %d response chunks", h.chunks, h.maxChunks)
+	}
+	h.chunks++
+	return nil
 }
 
 func (h *chReqHandler) RawRequest() ([]byte, error) {
+	if h.r == nil { // the method has no request data
+		return nil, nil
+	}
 	defer h.r.Close()
 	if h.invalidInputErr != nil {
 		return nil, h.invalidInputErr
@@ -219,6 +398,9 @@ func (h *chReqHandler) RawRequest() ([]byte, error) {
 
 func (h *chReqHandler) StreamSSZ(code ResponseCode, contextBytes []byte, data codec.Serializable) error {
 	respSize := data.ByteLength()
+	if err := h.nextChunk(code, respSize); err != nil {
+		return err
+	}
 	reqTo := writerToFn(func(w io.Writer) (n int64, err error) {
 		// re-use the same buffer to smooth write performance
 		h.respBuf.Reset(w)
@@ -229,10 +411,16 @@ func (h *chReqHandler) StreamSSZ(code ResponseCode, contextBytes []byte, data co
 }
 
 func (h *chReqHandler) WriteRawResponseChunk(code ResponseCode, contextBytes []byte, chunk []byte) error {
+	if err := h.nextChunk(code, uint64(len(chunk))); err != nil {
+		return err
+	}
 	return StreamChunk(code, uint64(len(chunk)), contextBytes, bytes.NewReader(chunk), h.w, h.m.Compression)
 }
 
 func (h *chReqHandler) StreamResponseChunk(code ResponseCode, contextBytes []byte, size uint64, r io.WriterTo) error {
+	if err := h.nextChunk(code, size); err != nil {
+		return err
+	}
 	return StreamChunk(code, size, contextBytes, r, h.w, h.m.Compression)
 }
 
@@ -242,15 +430,41 @@ func (h *chReqHandler) WriteErrorChunk(code ResponseCode, msg string) error {
 		msg += "..."
 	}
 	b := []byte(msg)
+	if err := h.nextChunk(code, uint64(len(b))); err != nil {
+		return err
+	}
 	return StreamChunk(code, uint64(len(b)), nil, bytes.NewReader(b), h.w, h.m.Compression)
 }
 
 type OnRequestListener func(ctx context.Context, peerId peer.ID, handler ChunkedRequestHandler)
 
+// MakeStreamHandler builds a stream handler that serves requests with the listener,
+// wrapped by the ServerMiddleware of the method, if any.
 func (m *Method) MakeStreamHandler(newCtx StreamCtxFn, listener OnRequestListener) network.StreamHandler {
+	return m.makeStreamHandler(newCtx, m.wrapListener(listener))
+}
+
+// wrapListener wraps the listener with the ServerMiddleware of the method, if any.
+func (m *Method) wrapListener(listener OnRequestListener) OnRequestListener {
+	if len(m.ServerMiddleware) == 0 {
+		return listener
+	}
+	return ChainServer(m.ServerMiddleware...)(m, listener)
+}
+
+// makeStreamHandler builds a stream handler that serves requests with the listener as-is.
+func (m *Method) makeStreamHandler(newCtx StreamCtxFn, listener OnRequestListener) network.StreamHandler {
 	return RequestPayloadHandler(func(ctx context.Context, peerId peer.ID, requestLen uint64, r io.ReadCloser, w io.Writer, comp Compression, invalidInputErr error) {
-		listener(ctx, peerId, &chReqHandler{
+		h := &chReqHandler{
 			m: m, respBuf: *bufio.NewWriterSize(w, 1024), reqLen: requestLen, r: r, w: w, invalidInputErr: invalidInputErr,
-		})
-	}).MakeStreamHandler(newCtx, m.Compression, m.RequestMinMax.Min, m.RequestMinMax.Max)
+		}
+		if m.RequestMinMax.Max == 0 {
+			// There is no request to read, the response limit applies right away.
+			if err := h.limitChunks(nil); err != nil {
+				_ = h.WriteErrorChunk(ServerErrCode, "failed to determine max response chunks")
+				return
+			}
+		}
+		listener(ctx, peerId, h)
+	}).makeStreamHandler(newCtx, m.Compression, m.RequestMinMax.Min, m.RequestMinMax.Max, m.maxPayloadSize())
 }
@@ -0,0 +1,76 @@
+package reqresp
+
+import (
+	"context"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"github.com/protolambda/ztyp/codec"
+)
+
+// MethodGroup is a set of versions of the same method, in order of preference, e.g. BlocksByRange v2 and v1.
+type MethodGroup []*Method
+
+// Protocols lists the protocol IDs of the versions, in order of preference.
+func (g MethodGroup) Protocols() []protocol.ID {
+	out := make([]protocol.ID, len(g))
+	for i, m := range g {
+		out[i] = m.Protocol
+	}
+	return out
+}
+
+// Method returns the version with the given protocol ID, or nil if the group does not have it.
+func (g MethodGroup) Method(protocolId protocol.ID) *Method {
+	for _, m := range g {
+		if m.Protocol == protocolId {
+			return m
+		}
+	}
+	return nil
+}
+
+// VersionedResponseListener processes a response chunk of the version of the method that was negotiated with the peer.
+type VersionedResponseListener func(m *Method, chunk ChunkedResponseHandler) error
+
+// RunRequest sends the request with the most preferred version that the peer supports,
+// and processes the response chunks with the context-bytes and limits of that version.
+// The request must be valid for each of the versions. The negotiated version is returned, nil if there is none.
+// The request runs through the ClientMiddleware of the negotiated version.
+// The version is negotiated before the middleware runs: the middleware can still veto the request by not calling next,
+// and the negotiated stream is then reset. Middleware can only open the negotiated stream once,
+// a second call to next, e.g. to retry, fails without writing to the stream.
+func (g MethodGroup) RunRequest(ctx context.Context, newStreamFn NewStreamFn,
+	peerId peer.ID, req codec.Serializable, maxRespChunks uint64, onResponse VersionedResponseListener) (*Method, error) {
+
+	if len(g) == 0 {
+		return nil, fmt.Errorf("no method versions to request with")
+	}
+	stream, err := newStreamFn(ctx, peerId, g.Protocols()...)
+	if err != nil {
+		return nil, err
+	}
+	m := g.Method(stream.Protocol())
+	if m == nil {
+		_ = stream.Reset()
+		return nil, fmt.Errorf("peer negotiated unexpected protocol %s", stream.Protocol())
+	}
+	// Run the request with the negotiated version, on the stream that is already open.
+	used := false
+	opened := NewStreamFn(func(ctx context.Context, peerId peer.ID, protocolId ...protocol.ID) (network.Stream, error) {
+		if used {
+			return nil, fmt.Errorf("negotiated stream of %s was already used", m.Protocol)
+		}
+		used = true
+		return stream, nil
+	})
+	err = m.RunRequest(ctx, opened, peerId, req, maxRespChunks, func(chunk ChunkedResponseHandler) error {
+		return onResponse(m, chunk)
+	})
+	if !used || err != nil {
+		// the request may have been invalid, or stopped by middleware, before using the stream.
+		_ = stream.Reset()
+	}
+	return m, err
+}
@@ -0,0 +1,39 @@
+package reqresp
+
+import (
+	"context"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/protolambda/ztyp/codec"
+)
+
+// RequestFn runs a request of a method, see Method.RunRequest.
+type RequestFn func(ctx context.Context, newStreamFn NewStreamFn,
+	peerId peer.ID, req codec.Serializable, maxRespChunks uint64, onResponse OnResponseListener) error
+
+// ClientMiddleware wraps the requests of a method. It may inspect or change the request,
+// wrap onResponse to inspect the response chunks, or not call next at all.
+type ClientMiddleware func(m *Method, next RequestFn) RequestFn
+
+// ServerMiddleware wraps the listener of a method. It may wrap the handler to inspect the request and response chunks,
+// or respond by itself without calling next at all.
+type ServerMiddleware func(m *Method, next OnRequestListener) OnRequestListener
+
+// ChainClient composes the middleware, the first is the outermost.
+func ChainClient(mws ...ClientMiddleware) ClientMiddleware {
+	return func(m *Method, next RequestFn) RequestFn {
+		for i := len(mws) - 1; i >= 0; i-- {
+			next = mws[i](m, next)
+		}
+		return next
+	}
+}
+
+// ChainServer composes the middleware, the first is the outermost.
+func ChainServer(mws ...ServerMiddleware) ServerMiddleware {
+	return func(m *Method, next OnRequestListener) OnRequestListener {
+		for i := len(mws) - 1; i >= 0; i-- {
+			next = mws[i](m, next)
+		}
+		return next
+	}
+}
@@ -0,0 +1,219 @@
+package reqresp
+
+import (
+	"context"
+	"errors"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/view"
+	"reflect"
+	"testing"
+)
+
+// recordingHandler records the request and response codes of a served request.
+type recordingHandler struct {
+	ChunkedRequestHandler
+	req   codec.Deserializable
+	codes []ResponseCode
+}
+
+func (h *recordingHandler) ReadRequest(dest codec.Deserializable) error {
+	err := h.ChunkedRequestHandler.ReadRequest(dest)
+	h.req = dest
+	return err
+}
+
+func (h *recordingHandler) StreamSSZ(code ResponseCode, contextBytes []byte, data codec.Serializable) error {
+	h.codes = append(h.codes, code)
+	return h.ChunkedRequestHandler.StreamSSZ(code, contextBytes, data)
+}
+
+func (h *recordingHandler) WriteErrorChunk(code ResponseCode, msg string) error {
+	h.codes = append(h.codes, code)
+	return h.ChunkedRequestHandler.WriteErrorChunk(code, msg)
+}
+
+type servedRequest struct {
+	peerId peer.ID
+	method *Method
+	req    codec.Deserializable
+	codes  []ResponseCode
+}
+
+func TestMiddleware(t *testing.T) {
+	server, client := testPeers(t)
+
+	var order []string
+	named := func(name string) ServerMiddleware {
+		return func(m *Method, next OnRequestListener) OnRequestListener {
+			return func(ctx context.Context, peerId peer.ID, handler ChunkedRequestHandler) {
+				order = append(order, name)
+				next(ctx, peerId, handler)
+			}
+		}
+	}
+	served := make(chan servedRequest, 10)
+	logging := func(m *Method, next OnRequestListener) OnRequestListener {
+		return func(ctx context.Context, peerId peer.ID, handler ChunkedRequestHandler) {
+			rec := &recordingHandler{ChunkedRequestHandler: handler}
+			next(ctx, peerId, rec)
+			served <- servedRequest{peerId: peerId, method: m, req: rec.req, codes: rec.codes}
+		}
+	}
+	denied := map[peer.ID]bool{}
+	auth := func(m *Method, next OnRequestListener) OnRequestListener {
+		return func(ctx context.Context, peerId peer.ID, handler ChunkedRequestHandler) {
+			if denied[peerId] {
+				_, _ = handler.RawRequest() // drain the request, it is not served.
+				_ = handler.WriteErrorChunk(ResourceUnavailableCode, "denied")
+				return
+			}
+			next(ctx, peerId, handler)
+		}
+	}
+
+	a := testMethod("a")
+	a.ServerMiddleware = []ServerMiddleware{named("method"), auth}
+	b := testMethod("b")
+	router := NewRouter(server, context.Background)
+	router.Use(named("router"), logging)
+	if err := router.Reconfigure([]Route{
+		{Method: &a, Listener: serveUint(123)},
+		{Method: &b, Listener: serveUint(42)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// client middleware counts the response chunks, and may inject faults
+	chunks := 0
+	counting := func(m *Method, next RequestFn) RequestFn {
+		return func(ctx context.Context, newStreamFn NewStreamFn, peerId peer.ID, req codec.Serializable,
+			maxRespChunks uint64, onResponse OnResponseListener) error {
+			return next(ctx, newStreamFn, peerId, req, maxRespChunks, func(chunk ChunkedResponseHandler) error {
+				chunks++
+				return onResponse(chunk)
+			})
+		}
+	}
+	errFault := errors.New("injected fault")
+	fault := false
+	faults := func(m *Method, next RequestFn) RequestFn {
+		return func(ctx context.Context, newStreamFn NewStreamFn, peerId peer.ID, req codec.Serializable,
+			maxRespChunks uint64, onResponse OnResponseListener) error {
+			if fault {
+				return errFault
+			}
+			return next(ctx, newStreamFn, peerId, req, maxRespChunks, onResponse)
+		}
+	}
+	a.ClientMiddleware = []ClientMiddleware{counting, faults}
+
+	ctx := context.Background()
+	got, err := requestUint(ctx, &a, client.NewStream, server.ID(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 123 {
+		t.Errorf("expected response 123, got %d", got)
+	}
+	if chunks != 1 {
+		t.Errorf("expected 1 chunk, got %d", chunks)
+	}
+	if !reflect.DeepEqual(order, []string{"router", "method"}) {
+		t.Errorf("unexpected middleware order %v", order)
+	}
+	req := <-served
+	if req.peerId != client.ID() {
+		t.Errorf("unexpected peer %s", req.peerId)
+	}
+	if req.method.Protocol != a.Protocol {
+		t.Errorf("unexpected method %s", req.method.Protocol)
+	}
+	if v, ok := req.req.(*view.Uint64View); !ok || *v != 10 {
+		t.Errorf("unexpected request %v", req.req)
+	}
+	if !reflect.DeepEqual(req.codes, []ResponseCode{SuccessCode}) {
+		t.Errorf("unexpected response codes %v", req.codes)
+	}
+
+	// router middleware applies to all routes, method middleware only to its own method
+	order = nil
+	if _, err := requestUint(ctx, &b, client.NewStream, server.ID(), 1); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(order, []string{"router"}) {
+		t.Errorf("unexpected middleware order %v", order)
+	}
+	<-served
+
+	denied[client.ID()] = true
+	_, err = requestUint(ctx, &a, client.NewStream, server.ID(), 10)
+	if !reflect.DeepEqual(err, &ErrorResponse{Code: ResourceUnavailableCode, Msg: "denied"}) {
+		t.Errorf("expected denied error response, got %v", err)
+	}
+	req = <-served
+	if req.req != nil {
+		t.Errorf("denied request should not be read, got %v", req.req)
+	}
+	if !reflect.DeepEqual(req.codes, []ResponseCode{ResourceUnavailableCode}) {
+		t.Errorf("unexpected response codes %v", req.codes)
+	}
+
+	fault = true
+	if _, err := requestUint(ctx, &a, client.NewStream, server.ID(), 10); err != errFault {
+		t.Errorf("expected injected fault, got %v", err)
+	}
+	if chunks != 2 {
+		t.Errorf("expected 2 chunks, got %d", chunks)
+	}
+
+	// method groups run the middleware of the negotiated version
+	chunks = 0
+	fault = false
+	denied[client.ID()] = false
+	_, err = MethodGroup{&a}.RunRequest(ctx, client.NewStream, server.ID(), view.Uint64View(10), 1,
+		func(m *Method, chunk ChunkedResponseHandler) error {
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chunks != 1 {
+		t.Errorf("expected 1 chunk, got %d", chunks)
+	}
+	<-served
+
+	// middleware can veto a group request after negotiation, and cannot reuse the negotiated stream
+	errVeto := errors.New("vetoed")
+	veto := true
+	var retryErr error
+	vetoing := func(m *Method, next RequestFn) RequestFn {
+		return func(ctx context.Context, newStreamFn NewStreamFn, peerId peer.ID, req codec.Serializable,
+			maxRespChunks uint64, onResponse OnResponseListener) error {
+			if veto {
+				return errVeto
+			}
+			if err := next(ctx, newStreamFn, peerId, req, maxRespChunks, onResponse); err != nil {
+				return err
+			}
+			retryErr = next(ctx, newStreamFn, peerId, req, maxRespChunks, onResponse)
+			return nil
+		}
+	}
+	a.ClientMiddleware = []ClientMiddleware{vetoing}
+	group := MethodGroup{&a}
+	noop := func(m *Method, chunk ChunkedResponseHandler) error {
+		return nil
+	}
+	if _, err := group.RunRequest(ctx, client.NewStream, server.ID(), view.Uint64View(10), 1, noop); err != errVeto {
+		t.Errorf("expected vetoed request, got %v", err)
+	}
+	veto = false
+	if _, err := group.RunRequest(ctx, client.NewStream, server.ID(), view.Uint64View(10), 1, noop); err != nil {
+		t.Fatal(err)
+	}
+	if retryErr == nil {
+		t.Error("expected the negotiated stream not to be reused")
+	}
+	<-served
+}
@@ -0,0 +1,82 @@
+package reqresp
+
+import (
+	"bytes"
+	"context"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"github.com/protolambda/ztyp/view"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func expectMaxPayloadSizeErr(t *testing.T, err error) {
+	t.Helper()
+	if err == nil || !strings.Contains(err.Error(), "exceeds max payload size") {
+		t.Fatalf("expected max payload size error, got %v", err)
+	}
+}
+
+func TestRequestMaxPayloadSize(t *testing.T) {
+	m := &Method{
+		Protocol:       "/test/max_payload/1",
+		RequestMinMax:  MinMaxSize{Min: 0, Max: 100},
+		MaxPayloadSize: 4,
+	}
+	noStream := NewStreamFn(func(ctx context.Context, peerId peer.ID, protocolId ...protocol.ID) (network.Stream, error) {
+		t.Fatal("no stream should be opened for a request that is too large")
+		return nil, nil
+	})
+	err := m.RunRequest(context.Background(), noStream, "", view.Uint64View(42), 1,
+		func(chunk ChunkedResponseHandler) error {
+			return nil
+		})
+	expectMaxPayloadSizeErr(t, err)
+}
+
+func TestResponseChunkMaxPayloadSize(t *testing.T) {
+	var buf bytes.Buffer
+	h := &chReqHandler{m: &Method{MaxPayloadSize: 4}, w: &buf}
+	if err := h.WriteRawResponseChunk(SuccessCode, nil, []byte{1, 2, 3, 4}); err != nil {
+		t.Fatal(err)
+	}
+	written := buf.Len()
+	expectMaxPayloadSizeErr(t, h.WriteRawResponseChunk(SuccessCode, nil, []byte{1, 2, 3, 4, 5}))
+	if buf.Len() != written {
+		t.Error("nothing should be written if the chunk is too large")
+	}
+}
+
+func TestResponseMaxPayloadSize(t *testing.T) {
+	// a method with loose bounds
+	looseContext := func(blr *BufLimitReader) ([]byte, MinMaxSize, error) {
+		return nil, MinMaxSize{Min: 0, Max: 1 << 30}, nil
+	}
+	for name, comp := range map[string]Compression{"uncompressed": nil, "snappy": SnappyCompression{}} {
+		comp := comp
+		t.Run(name, func(t *testing.T) {
+			var resp bytes.Buffer
+			payload := make([]byte, 100)
+			if err := StreamChunk(SuccessCode, uint64(len(payload)), nil, bytes.NewReader(payload), &resp, comp); err != nil {
+				t.Fatal(err)
+			}
+			encoded := resp.Bytes()
+
+			read := func(maxPayloadSize uint64) error {
+				handle := ResponseChunkHandler(func(ctx context.Context, chunkIndex uint64, chunkSize uint64,
+					result ResponseCode, contextBytes []byte, r io.Reader) error {
+					_, err := io.ReadFull(r, make([]byte, chunkSize))
+					return err
+				}).makeResponseHandler(1, looseContext, comp, maxPayloadSize)
+				return handle(context.Background(), ioutil.NopCloser(bytes.NewReader(encoded)))
+			}
+			if err := read(100); err != nil {
+				t.Fatalf("expected chunk within max payload size to be accepted: %v", err)
+			}
+			expectMaxPayloadSizeErr(t, read(99))
+		})
+	}
+}
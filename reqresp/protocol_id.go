@@ -0,0 +1,91 @@
+package reqresp
+
+import (
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"strconv"
+	"strings"
+)
+
+// BeaconChainReqPrefix is the protocol prefix of the beacon chain req-resp methods.
+const BeaconChainReqPrefix = "/eth2/beacon_chain/req"
+
+// ProtocolID is a req-resp protocol ID, formatted as /ProtocolPrefix/MessageName/SchemaVersion/Encoding,
+// e.g. /eth2/beacon_chain/req/beacon_blocks_by_range/1/ssz_snappy
+type ProtocolID struct {
+	// Prefix of the protocol, starting with a slash, e.g. BeaconChainReqPrefix
+	Prefix string
+	// MessageName, e.g. beacon_blocks_by_range
+	MessageName string
+	// SchemaVersion of the request and response types, starting at 1.
+	SchemaVersion uint64
+	// Encoding of requests and response chunks, e.g. ssz_snappy. See SSZEncoding.
+	Encoding string
+}
+
+// SSZEncoding is the encoding name of SSZ with the given compression, e.g. ssz_snappy. Compression may be nil.
+func SSZEncoding(comp Compression) string {
+	if comp == nil {
+		return "ssz"
+	}
+	return "ssz_" + comp.Name()
+}
+
+// BeaconChainProtocol formats the ID of a beacon chain req-resp method, with SSZ encoding and the given compression.
+func BeaconChainProtocol(messageName string, schemaVersion uint64, comp Compression) protocol.ID {
+	return ProtocolID{
+		Prefix:        BeaconChainReqPrefix,
+		MessageName:   messageName,
+		SchemaVersion: schemaVersion,
+		Encoding:      SSZEncoding(comp),
+	}.ID()
+}
+
+func (p ProtocolID) String() string {
+	return fmt.Sprintf("%s/%s/%d/%s", p.Prefix, p.MessageName, p.SchemaVersion, p.Encoding)
+}
+
+// ID formats the protocol ID.
+func (p ProtocolID) ID() protocol.ID {
+	return protocol.ID(p.String())
+}
+
+// ParseProtocolID parses a protocol ID formatted as /ProtocolPrefix/MessageName/SchemaVersion/Encoding.
+func ParseProtocolID(id protocol.ID) (ProtocolID, error) {
+	s := string(id)
+	if !strings.HasPrefix(s, "/") {
+		return ProtocolID{}, fmt.Errorf("protocol ID %q does not start with a slash", s)
+	}
+	parts := strings.Split(s, "/")
+	// the leading slash results in an empty first part
+	if len(parts) < 5 {
+		return ProtocolID{}, fmt.Errorf("protocol ID %q does not have a prefix, message name, schema version and encoding", s)
+	}
+	n := len(parts)
+	prefix, name, version, encoding := strings.Join(parts[:n-3], "/"), parts[n-3], parts[n-2], parts[n-1]
+	if prefix == "" || name == "" || encoding == "" {
+		return ProtocolID{}, fmt.Errorf("protocol ID %q has empty parts", s)
+	}
+	v, err := strconv.ParseUint(version, 10, 64)
+	if err != nil {
+		return ProtocolID{}, fmt.Errorf("protocol ID %q has invalid schema version: %v", s, err)
+	}
+	return ProtocolID{Prefix: prefix, MessageName: name, SchemaVersion: v, Encoding: encoding}, nil
+}
+
+// ProtocolID parses the protocol ID of the method.
+func (m *Method) ProtocolID() (ProtocolID, error) {
+	return ParseProtocolID(m.Protocol)
+}
+
+// FilterMethods returns the methods with a protocol ID accepted by keep, in the same order.
+// Methods with a protocol ID that cannot be parsed are left out.
+func FilterMethods(methods []*Method, keep func(id ProtocolID) bool) []*Method {
+	var out []*Method
+	for _, m := range methods {
+		if id, err := m.ProtocolID(); err == nil && keep(id) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
@@ -0,0 +1,66 @@
+package reqresp
+
+import (
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"testing"
+)
+
+func TestParseProtocolID(t *testing.T) {
+	id := protocol.ID("/eth2/beacon_chain/req/beacon_blocks_by_range/2/ssz_snappy")
+	p, err := ParseProtocolID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := ProtocolID{
+		Prefix:        BeaconChainReqPrefix,
+		MessageName:   "beacon_blocks_by_range",
+		SchemaVersion: 2,
+		Encoding:      "ssz_snappy",
+	}
+	if p != expected {
+		t.Errorf("unexpected protocol ID %#v", p)
+	}
+	if p.ID() != id {
+		t.Errorf("formatted protocol ID %q does not match parsed %q", p.ID(), id)
+	}
+	if got := BeaconChainProtocol("beacon_blocks_by_range", 2, SnappyCompression{}); got != id {
+		t.Errorf("unexpected beacon chain protocol ID %q", got)
+	}
+	if got := SSZEncoding(nil); got != "ssz" {
+		t.Errorf("unexpected encoding without compression %q", got)
+	}
+
+	for _, bad := range []protocol.ID{
+		"",
+		"eth2/beacon_chain/req/status/1/ssz_snappy",
+		"/status/1/ssz_snappy",
+		"/eth2/beacon_chain/req/status/v1/ssz_snappy",
+		"/eth2/beacon_chain/req//1/ssz_snappy",
+		"/eth2/beacon_chain/req/status/1/",
+	} {
+		if _, err := ParseProtocolID(bad); err == nil {
+			t.Errorf("expected error for protocol ID %q", bad)
+		}
+	}
+}
+
+func TestFilterMethods(t *testing.T) {
+	methods := []*Method{
+		{Protocol: BeaconChainProtocol("beacon_blocks_by_range", 2, SnappyCompression{})},
+		{Protocol: BeaconChainProtocol("beacon_blocks_by_range", 1, SnappyCompression{})},
+		{Protocol: BeaconChainProtocol("status", 1, SnappyCompression{})},
+		{Protocol: "/not/a/protocol"},
+	}
+	byRange := FilterMethods(methods, func(id ProtocolID) bool {
+		return id.MessageName == "beacon_blocks_by_range"
+	})
+	if len(byRange) != 2 || byRange[0] != methods[0] || byRange[1] != methods[1] {
+		t.Errorf("unexpected by-range methods %v", byRange)
+	}
+	v1 := FilterMethods(methods, func(id ProtocolID) bool {
+		return id.SchemaVersion == 1
+	})
+	if len(v1) != 2 || v1[0] != methods[1] || v1[1] != methods[2] {
+		t.Errorf("unexpected v1 methods %v", v1)
+	}
+}
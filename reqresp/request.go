@@ -11,18 +11,44 @@ import (
 
 type NewStreamFn func(ctx context.Context, peerId peer.ID, protocolId ...protocol.ID) (network.Stream, error)
 
+// Request opens a stream, writes the request payload, and handles the response.
+// If r is nil, no request payload is written at all, not even a size header.
 func (newStreamFn NewStreamFn) Request(ctx context.Context, peerId peer.ID, protocolId protocol.ID, size uint64, r io.WriterTo, comp Compression, handle ResponseHandler) error {
-	stream, err := newStreamFn(ctx, peerId, protocolId)
+	stream, err := newStreamFn.Open(ctx, peerId, protocolId, size, r, comp)
 	if err != nil {
 		return err
 	}
+	return handle(ctx, readAndCloseFn{Reader: stream, close: stream.CloseRead})
+}
+
+// Open opens a stream, writes the request payload, and closes the writing side.
+// The response is left to be read from the returned stream.
+// If r is nil, no request payload is written at all, not even a size header.
+func (newStreamFn NewStreamFn) Open(ctx context.Context, peerId peer.ID, protocolId protocol.ID, size uint64, r io.WriterTo, comp Compression) (network.Stream, error) {
+	stream, err := newStreamFn(ctx, peerId, protocolId)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeRequest(stream, size, r, comp); err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// writeRequest writes the request payload, if any, and closes the writing side of the stream.
+// The stream is reset if writing fails.
+func writeRequest(stream network.Stream, size uint64, r io.WriterTo, comp Compression) error {
 	// TODO: test if additional bufio is necessary
-	if err := StreamHeaderAndPayload(size, r, stream, comp); err != nil {
-		return err
+	if r != nil {
+		if err := StreamHeaderAndPayload(size, r, stream, comp); err != nil {
+			_ = stream.Reset()
+			return err
+		}
 	}
 	// close writing side
 	if err := stream.CloseWrite(); err != nil {
+		_ = stream.Reset()
 		return fmt.Errorf("failed to close writing side: %v", err)
 	}
-	return handle(ctx, readAndCloseFn{Reader: stream, close: stream.CloseRead})
+	return nil
 }
@@ -0,0 +1,108 @@
+package reqresp
+
+import (
+	"context"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/protolambda/ztyp/codec"
+	"io"
+)
+
+// ResponseResult is a decoded response chunk, or the error that ended the response.
+type ResponseResult struct {
+	ChunkIndex uint64
+	// ResultCode of the chunk. Not set if the response ended with an error before reading a chunk.
+	ResultCode ResponseCode
+	// ContextBytes of the chunk. Nil if the method has no context, or if the result code is not SuccessCode.
+	ContextBytes []byte
+	// Obj is the decoded chunk. Nil if Err is set.
+	Obj codec.Deserializable
+	// Err is an *ErrorResponse if the result code is not SuccessCode,
+	// or the error that ended the response otherwise, in which case it is the last result.
+	Err error
+}
+
+// RunRequestAsync runs the request in the background, and sends each response chunk on the returned channel,
+// decoded into the destination created by makeDest. The channel is closed when the response ends.
+// The next chunk is not read before the previous result is received.
+// When the context is canceled, the stream is reset, and the channel is closed without sending any error.
+// The ClientMiddleware of the method does not apply, it wraps callback-based requests only.
+func (m *Method) RunRequestAsync(ctx context.Context, newStreamFn NewStreamFn,
+	peerId peer.ID, req codec.Serializable, maxRespChunks uint64,
+	makeDest func(contextBytes []byte) (codec.Deserializable, error)) <-chan ResponseResult {
+
+	out := make(chan ResponseResult)
+	send := func(res ResponseResult) error {
+		select {
+		case out <- res:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	handleChunks := ResponseChunkHandler(func(ctx context.Context, chunkIndex uint64, chunkSize uint64, result ResponseCode, contextBytes []byte, r io.Reader) error {
+		chunk := &chRespHandler{
+			m:            m,
+			r:            r,
+			result:       result,
+			chunkSize:    chunkSize,
+			chunkIndex:   chunkIndex,
+			contextBytes: contextBytes,
+		}
+		res := ResponseResult{ChunkIndex: chunkIndex, ResultCode: result, ContextBytes: contextBytes}
+		if result != SuccessCode {
+			res.Err = chunk.ReadErr()
+			if _, ok := res.Err.(*ErrorResponse); !ok {
+				// failed to read the error message, this ends the response.
+				return res.Err
+			}
+		} else {
+			var obj codec.Deserializable
+			err := chunk.ReadObj(func(contextBytes []byte) (codec.Deserializable, error) {
+				dest, err := makeDest(contextBytes)
+				obj = dest
+				return dest, err
+			})
+			if err != nil {
+				return fmt.Errorf("failed to decode response chunk %d: %v", chunkIndex, err)
+			}
+			res.Obj = obj
+		}
+		return send(res)
+	})
+
+	go func() {
+		defer close(out)
+		err := func() error {
+			reqSize, reqTo, err := m.requestPayload(req)
+			if err != nil {
+				return err
+			}
+			maxRespChunks, err := m.responseChunks(req, maxRespChunks)
+			if err != nil {
+				return err
+			}
+			stream, err := newStreamFn.Open(ctx, peerId, m.Protocol, reqSize, reqTo, m.Compression)
+			if err != nil {
+				return err
+			}
+			// Reading from the stream does not watch the context, resetting the stream stops it.
+			done := make(chan struct{})
+			defer close(done)
+			go func() {
+				select {
+				case <-ctx.Done():
+					_ = stream.Reset()
+				case <-done:
+				}
+			}()
+			respHandler := handleChunks.makeResponseHandler(maxRespChunks, m.ReadContextBytes, m.Compression, m.maxPayloadSize())
+			return respHandler(ctx, readAndCloseFn{Reader: stream, close: stream.CloseRead})
+		}()
+		if err != nil && ctx.Err() == nil {
+			_ = send(ResponseResult{Err: err})
+		}
+	}()
+	return out
+}
@@ -0,0 +1,78 @@
+package reqresp
+
+import (
+	"context"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/view"
+	"reflect"
+	"testing"
+)
+
+func TestRunRequestAsync(t *testing.T) {
+	server, client := testPeers(t)
+
+	m := testMethod("count")
+	server.SetStreamHandler(m.Protocol, m.MakeStreamHandler(context.Background, serveCount))
+	makeDest := func(contextBytes []byte) (codec.Deserializable, error) {
+		return new(view.Uint64View), nil
+	}
+
+	t.Run("all chunks", func(t *testing.T) {
+		var results []ResponseResult
+		for res := range m.RunRequestAsync(context.Background(), client.NewStream, server.ID(), view.Uint64View(3), 10, makeDest) {
+			results = append(results, res)
+		}
+		if len(results) != 4 {
+			t.Fatalf("expected 4 results, got %d", len(results))
+		}
+		for i := 0; i < 3; i++ {
+			res := results[i]
+			if res.Err != nil {
+				t.Fatalf("result %d: %v", i, res.Err)
+			}
+			if res.ChunkIndex != uint64(i) || res.ResultCode != SuccessCode {
+				t.Errorf("result %d: unexpected chunk %d with code %d", i, res.ChunkIndex, res.ResultCode)
+			}
+			if v := *res.Obj.(*view.Uint64View); v != view.Uint64View(i) {
+				t.Errorf("result %d: unexpected value %d", i, v)
+			}
+		}
+		last := results[3]
+		if last.ChunkIndex != 3 || last.Obj != nil {
+			t.Errorf("unexpected last result %v", last)
+		}
+		if !reflect.DeepEqual(last.Err, &ErrorResponse{Code: ResourceUnavailableCode, Msg: "done"}) {
+			t.Errorf("unexpected last error %v", last.Err)
+		}
+	})
+	t.Run("request error", func(t *testing.T) {
+		var results []ResponseResult
+		// the request is too small
+		for res := range m.RunRequestAsync(context.Background(), client.NewStream, server.ID(), view.Uint32View(3), 10, makeDest) {
+			results = append(results, res)
+		}
+		if len(results) != 1 || results[0].Err == nil {
+			t.Fatalf("expected a single error result, got %v", results)
+		}
+	})
+	t.Run("cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		results := m.RunRequestAsync(ctx, client.NewStream, server.ID(), view.Uint64View(100), 100, makeDest)
+		res := <-results
+		if res.Err != nil {
+			t.Fatal(res.Err)
+		}
+		if v := *res.Obj.(*view.Uint64View); v != 0 {
+			t.Fatalf("unexpected value %d", v)
+		}
+		cancel()
+		// Results that were ready may still be received, but the response stops and the channel is closed.
+		count := 0
+		for range results {
+			count++
+		}
+		if count >= 99 {
+			t.Errorf("expected the response to stop, got %d more results", count)
+		}
+	})
+}
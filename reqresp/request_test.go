@@ -2,7 +2,13 @@ package reqresp
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/protolambda/ztyp/codec"
+	"io"
 	"testing"
 )
 
@@ -33,3 +39,69 @@ func TestStreamHeaderAndPayload(t *testing.T) {
 		t.Error("unexpected encoding output")
 	}
 }
+
+func testPeers(t *testing.T) (server host.Host, client host.Host) {
+	t.Helper()
+	mNet := mocknet.New()
+	server, err := mNet.GenPeer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err = mNet.GenPeer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mNet.LinkAll(); err != nil {
+		t.Fatal(err)
+	}
+	if err := mNet.ConnectAllButSelf(); err != nil {
+		t.Fatal(err)
+	}
+	return server, client
+}
+
+type emptyReq struct{}
+
+func (emptyReq) Serialize(w *codec.EncodingWriter) error {
+	return nil
+}
+
+func (emptyReq) ByteLength() uint64 {
+	return 0
+}
+
+func (emptyReq) FixedLength() uint64 {
+	return 0
+}
+
+func (*emptyReq) Deserialize(dr *codec.DecodingReader) error {
+	return nil
+}
+
+func TestEmptyRequestEncoding(t *testing.T) {
+	server, client := testPeers(t)
+
+	// a method without request data, like metadata
+	m := &Method{
+		Protocol:      "/eth2/test/req/empty/1/ssz_snappy",
+		RequestMinMax: MinMaxSize{Min: 0, Max: 0},
+		Compression:   SnappyCompression{},
+	}
+	received := make(chan []byte, 1)
+	server.SetStreamHandler(m.Protocol, func(stream network.Stream) {
+		defer stream.Close()
+		data, _ := io.ReadAll(stream)
+		received <- data
+	})
+	err := m.RunRequest(context.Background(), client.NewStream, server.ID(), emptyReq{}, 1,
+		func(chunk ChunkedResponseHandler) error {
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// nothing is written, not even a size header or the snappy stream identifier
+	if data := <-received; len(data) != 0 {
+		t.Errorf("expected empty request encoding, got %x", data)
+	}
+}
@@ -0,0 +1,52 @@
+package reqresp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestResponseChunksLimit(t *testing.T) {
+	newHandler := func(maxChunks uint64) *chReqHandler {
+		return &chReqHandler{m: &Method{}, w: new(bytes.Buffer), limited: true, maxChunks: maxChunks}
+	}
+
+	t.Run("error chunk without success chunks", func(t *testing.T) {
+		h := newHandler(0)
+		if err := h.WriteRawResponseChunk(SuccessCode, nil, []byte{1}); err == nil {
+			t.Error("expected success chunk to be over the limit")
+		}
+		if err := h.WriteErrorChunk(InvalidReqCode, "bad request"); err != nil {
+			t.Errorf("expected error chunk to be allowed: %v", err)
+		}
+	})
+	t.Run("error chunk after success chunks", func(t *testing.T) {
+		h := newHandler(2)
+		for i := 0; i < 2; i++ {
+			if err := h.WriteRawResponseChunk(SuccessCode, nil, []byte{1}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := h.WriteRawResponseChunk(SuccessCode, nil, []byte{1}); err == nil {
+			t.Error("expected success chunk to be over the limit")
+		}
+		if err := h.WriteErrorChunk(ResourceUnavailableCode, "no more"); err != nil {
+			t.Errorf("expected error chunk to be allowed: %v", err)
+		}
+	})
+	t.Run("nothing after error chunk", func(t *testing.T) {
+		h := newHandler(2)
+		if err := h.WriteErrorChunk(ServerErrCode, "failed"); err != nil {
+			t.Fatal(err)
+		}
+		written := h.w.(*bytes.Buffer).Len()
+		if err := h.WriteRawResponseChunk(SuccessCode, nil, []byte{1}); err == nil {
+			t.Error("expected no success chunk after the error chunk")
+		}
+		if err := h.WriteErrorChunk(ServerErrCode, "again"); err == nil {
+			t.Error("expected no error chunk after the error chunk")
+		}
+		if h.w.(*bytes.Buffer).Len() != written {
+			t.Error("nothing should be written after the error chunk")
+		}
+	})
+}
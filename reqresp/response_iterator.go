@@ -0,0 +1,114 @@
+package reqresp
+
+import (
+	"context"
+	"errors"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/protolambda/ztyp/codec"
+	"io"
+	"time"
+)
+
+// ErrIteratorClosed is returned when reading from a closed ResponseIterator.
+var ErrIteratorClosed = errors.New("response iterator is closed")
+
+// ResponseIterator reads the response chunks of a request one at a time.
+type ResponseIterator interface {
+	// Next reads the next response chunk, up to its contents. It returns io.EOF when there are no chunks left.
+	// Any unread contents of the previous chunk are skipped: the previous chunk is invalid after calling Next.
+	// The context deadline, if any, is applied as read deadline of the stream, if the stream supports deadlines.
+	// If the context is done before the chunk is read, the stream is reset, and the context error is returned.
+	Next(ctx context.Context) (ChunkedResponseHandler, error)
+	// Close stops reading the response. It must be called when done, also if not all chunks were read.
+	// If Next returned an error other than io.EOF, the stream is already reset, and Close is a no-op.
+	Close() error
+}
+
+type responseIterator struct {
+	m      *Method
+	stream network.Stream
+	chunks *chunkReader
+	closed bool
+	// if a read deadline was set, to reset it when reading without deadline.
+	deadline bool
+}
+
+func (it *responseIterator) Next(ctx context.Context) (ChunkedResponseHandler, error) {
+	if it.closed {
+		return nil, ErrIteratorClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		// Best-effort: not every stream transport supports deadlines.
+		_ = it.stream.SetReadDeadline(deadline)
+		it.deadline = true
+	} else if it.deadline {
+		_ = it.stream.SetReadDeadline(time.Time{})
+		it.deadline = false
+	}
+	// Reading from the stream does not watch the context, resetting the stream stops it.
+	done := make(chan struct{})
+	cancelled := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = it.stream.Reset()
+			cancelled <- true
+		case <-done:
+			cancelled <- false
+		}
+	}()
+	chunk, err := it.chunks.next()
+	close(done)
+	if <-cancelled {
+		it.closed = true
+		return nil, ctx.Err()
+	}
+	if err == io.EOF {
+		return nil, err
+	}
+	if err != nil {
+		// The response is invalid or could not be read: stop reading it, and release the stream right away.
+		it.closed = true
+		_ = it.stream.Reset()
+		return nil, err
+	}
+	chunk.m = it.m
+	return chunk, nil
+}
+
+func (it *responseIterator) Close() error {
+	if it.closed {
+		return nil
+	}
+	it.closed = true
+	return it.stream.CloseRead()
+}
+
+// OpenRequest sends the request to the peer, and returns an iterator to read the response chunks with, at the pace of the caller.
+// At most maxRespChunks chunks are read, or less if the method limits it further. The iterator must be closed when done.
+// Iterated requests do not run through the ClientMiddleware of the method.
+func (m *Method) OpenRequest(ctx context.Context, newStreamFn NewStreamFn,
+	peerId peer.ID, req codec.Serializable, maxRespChunks uint64) (ResponseIterator, error) {
+
+	reqSize, reqTo, err := m.requestPayload(req)
+	if err != nil {
+		return nil, err
+	}
+	maxRespChunks, err = m.responseChunks(req, maxRespChunks)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := newStreamFn.Open(ctx, peerId, m.Protocol, reqSize, reqTo, m.Compression)
+	if err != nil {
+		return nil, err
+	}
+	return &responseIterator{
+		m:      m,
+		stream: stream,
+		chunks: newChunkReader(stream, maxRespChunks, m.ReadContextBytes, m.Compression, m.maxPayloadSize()),
+	}, nil
+}
@@ -0,0 +1,174 @@
+package reqresp
+
+import (
+	"context"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/view"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testMethod is a method with a uint64 request, and uint64 response chunks.
+func testMethod(name string) Method {
+	uintSize := MinMaxSize{Min: 8, Max: 8}
+	return Method{
+		Protocol:      protocol.ID("/eth2/test/req/" + name + "/1/ssz_snappy"),
+		RequestMinMax: uintSize,
+		Compression:   SnappyCompression{},
+		ReadContextBytes: func(blr *BufLimitReader) ([]byte, MinMaxSize, error) {
+			return nil, uintSize, nil
+		},
+	}
+}
+
+// serveCount responds with the requested count of chunks, and an error chunk after them.
+func serveCount(ctx context.Context, peerId peer.ID, handler ChunkedRequestHandler) {
+	var count view.Uint64View
+	if err := handler.ReadRequest(&count); err != nil {
+		_ = handler.WriteErrorChunk(InvalidReqCode, "bad request")
+		return
+	}
+	for i := view.Uint64View(0); i < count; i++ {
+		if err := handler.StreamSSZ(SuccessCode, nil, i); err != nil {
+			return
+		}
+	}
+	_ = handler.WriteErrorChunk(ResourceUnavailableCode, "done")
+}
+
+func TestOpenRequest(t *testing.T) {
+	server, client := testPeers(t)
+
+	m := testMethod("count")
+	server.SetStreamHandler(m.Protocol, m.MakeStreamHandler(context.Background, serveCount))
+
+	ctx := context.Background()
+	next := func(t *testing.T, it ResponseIterator) ChunkedResponseHandler {
+		t.Helper()
+		chunk, err := it.Next(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return chunk
+	}
+	expectUint := func(t *testing.T, chunk ChunkedResponseHandler, expected uint64) {
+		t.Helper()
+		var out view.Uint64View
+		if err := chunk.ReadObj(func(contextBytes []byte) (codec.Deserializable, error) {
+			return &out, nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if uint64(out) != expected {
+			t.Fatalf("expected %d, got %d", expected, out)
+		}
+	}
+
+	t.Run("read all", func(t *testing.T) {
+		it, err := m.OpenRequest(ctx, client.NewStream, server.ID(), view.Uint64View(3), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer it.Close()
+
+		expectUint(t, next(t, it), 0)
+		// the contents of the second chunk are skipped
+		if chunk := next(t, it); chunk.ChunkIndex() != 1 {
+			t.Fatalf("expected chunk 1, got %d", chunk.ChunkIndex())
+		}
+		expectUint(t, next(t, it), 2)
+
+		chunk := next(t, it)
+		if chunk.ResultCode() != ResourceUnavailableCode {
+			t.Fatalf("unexpected result code %d", chunk.ResultCode())
+		}
+		if err := chunk.ReadErr(); !reflect.DeepEqual(err, &ErrorResponse{Code: ResourceUnavailableCode, Msg: "done"}) {
+			t.Fatalf("unexpected error response %v", err)
+		}
+		if _, err := it.Next(ctx); err != io.EOF {
+			t.Fatalf("expected EOF, got %v", err)
+		}
+	})
+	t.Run("max chunks", func(t *testing.T) {
+		it, err := m.OpenRequest(ctx, client.NewStream, server.ID(), view.Uint64View(5), 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer it.Close()
+		expectUint(t, next(t, it), 0)
+		expectUint(t, next(t, it), 1)
+		if _, err := it.Next(ctx); err != io.EOF {
+			t.Fatalf("expected EOF, got %v", err)
+		}
+	})
+	t.Run("close early", func(t *testing.T) {
+		it, err := m.OpenRequest(ctx, client.NewStream, server.ID(), view.Uint64View(5), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectUint(t, next(t, it), 0)
+		if err := it.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := it.Next(ctx); err != ErrIteratorClosed {
+			t.Fatalf("expected closed iterator, got %v", err)
+		}
+	})
+	t.Run("cancel", func(t *testing.T) {
+		stalled := testMethod("stalled")
+		release := make(chan struct{})
+		defer close(release)
+		server.SetStreamHandler(stalled.Protocol, stalled.MakeStreamHandler(context.Background,
+			func(ctx context.Context, peerId peer.ID, handler ChunkedRequestHandler) {
+				if _, err := handler.RawRequest(); err != nil {
+					return
+				}
+				_ = handler.StreamSSZ(SuccessCode, nil, view.Uint64View(0))
+				<-release
+			}))
+		// a context without deadline, the stream is reset when it is cancelled
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		it, err := stalled.OpenRequest(ctx, client.NewStream, server.ID(), view.Uint64View(2), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectUint(t, next(t, it), 0)
+		time.AfterFunc(50*time.Millisecond, cancel)
+		if _, err := it.Next(ctx); err != context.Canceled {
+			t.Fatalf("expected cancelled read, got %v", err)
+		}
+		if _, err := it.Next(context.Background()); err != ErrIteratorClosed {
+			t.Fatalf("expected closed iterator, got %v", err)
+		}
+	})
+	t.Run("invalid chunk", func(t *testing.T) {
+		bad := testMethod("bad")
+		server.SetStreamHandler(bad.Protocol, bad.MakeStreamHandler(context.Background,
+			func(ctx context.Context, peerId peer.ID, handler ChunkedRequestHandler) {
+				if _, err := handler.RawRequest(); err != nil {
+					return
+				}
+				// a uint64 is 8 bytes, the response chunk is too large
+				_ = handler.WriteRawResponseChunk(SuccessCode, nil, make([]byte, 9))
+			}))
+		it, err := bad.OpenRequest(ctx, client.NewStream, server.ID(), view.Uint64View(1), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := it.Next(ctx); err == nil || err == io.EOF {
+			t.Fatalf("expected invalid chunk error, got %v", err)
+		}
+		// the stream is reset after the failure
+		if _, err := it.Next(ctx); err != ErrIteratorClosed {
+			t.Fatalf("expected closed iterator, got %v", err)
+		}
+		if err := it.Close(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
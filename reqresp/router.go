@@ -0,0 +1,179 @@
+package reqresp
+
+import (
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Route is a method, and the listener that serves its requests.
+type Route struct {
+	Method   *Method
+	Listener OnRequestListener
+}
+
+type routeEntry struct {
+	Route
+	handler network.StreamHandler
+}
+
+type routeTable map[protocol.ID]routeEntry
+
+// Router serves a set of methods on a host. The routes can be changed at any time:
+// streams are dispatched with the route table at the time the stream is opened,
+// and a change of routes applies all at once.
+type Router struct {
+	host   host.Host
+	newCtx StreamCtxFn
+	// serializes route changes
+	mu sync.Mutex
+	// wraps the listener of every route, outside of the middleware of the method itself.
+	middleware []ServerMiddleware
+	// the current routeTable, read without locking when dispatching streams.
+	table atomic.Value
+}
+
+// NewRouter creates a router without routes, to serve methods on the given host.
+// newCtx creates the context of each served stream.
+func NewRouter(h host.Host, newCtx StreamCtxFn) *Router {
+	r := &Router{host: h, newCtx: newCtx}
+	r.table.Store(routeTable{})
+	return r
+}
+
+func (r *Router) current() routeTable {
+	return r.table.Load().(routeTable)
+}
+
+// dispatch serves the stream with the current route of its protocol, or resets it if there is none.
+func (r *Router) dispatch(stream network.Stream) {
+	entry, ok := r.current()[stream.Protocol()]
+	if !ok {
+		_ = stream.Reset()
+		return
+	}
+	entry.handler(stream)
+}
+
+// apply switches to the next route table, and registers and unregisters protocols on the host to match it.
+func (r *Router) apply(next routeTable) {
+	prev := r.current()
+	r.table.Store(next)
+	for id := range next {
+		if _, ok := prev[id]; !ok {
+			r.host.SetStreamHandler(id, r.dispatch)
+		}
+	}
+	for id := range prev {
+		if _, ok := next[id]; !ok {
+			r.host.RemoveStreamHandler(id)
+		}
+	}
+}
+
+// entry prepares the stream handler of the route. The router lock must be held.
+func (r *Router) entry(route Route) (routeEntry, error) {
+	if route.Method == nil {
+		return routeEntry{}, fmt.Errorf("route has no method")
+	}
+	if route.Listener == nil {
+		return routeEntry{}, fmt.Errorf("route for %s has no listener", route.Method.Protocol)
+	}
+	listener := route.Method.wrapListener(route.Listener)
+	if len(r.middleware) > 0 {
+		listener = ChainServer(r.middleware...)(route.Method, listener)
+	}
+	return routeEntry{Route: route, handler: route.Method.makeStreamHandler(r.newCtx, listener)}, nil
+}
+
+// Handle adds the route, or replaces the route with the same protocol.
+func (r *Router) Handle(m *Method, listener OnRequestListener) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, err := r.entry(Route{Method: m, Listener: listener})
+	if err != nil {
+		return err
+	}
+	prev := r.current()
+	next := make(routeTable, len(prev)+1)
+	for id, e := range prev {
+		next[id] = e
+	}
+	next[m.Protocol] = entry
+	r.apply(next)
+	return nil
+}
+
+// Remove removes the routes of the given protocols, if any.
+func (r *Router) Remove(protocolIds ...protocol.ID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	prev := r.current()
+	next := make(routeTable, len(prev))
+	for id, e := range prev {
+		next[id] = e
+	}
+	for _, id := range protocolIds {
+		delete(next, id)
+	}
+	r.apply(next)
+}
+
+// Reconfigure replaces all routes. If any route is invalid, or if routes share a protocol,
+// an error is returned and the routes are left unchanged.
+func (r *Router) Reconfigure(routes []Route) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	next := make(routeTable, len(routes))
+	for _, route := range routes {
+		entry, err := r.entry(route)
+		if err != nil {
+			return err
+		}
+		if _, ok := next[route.Method.Protocol]; ok {
+			return fmt.Errorf("duplicate route for %s", route.Method.Protocol)
+		}
+		next[route.Method.Protocol] = entry
+	}
+	r.apply(next)
+	return nil
+}
+
+// Use adds server middleware to all current and future routes, after any middleware added before.
+// Router middleware wraps the ServerMiddleware of the methods.
+func (r *Router) Use(mws ...ServerMiddleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.middleware = append(r.middleware[:len(r.middleware):len(r.middleware)], mws...)
+	prev := r.current()
+	next := make(routeTable, len(prev))
+	for id, e := range prev {
+		entry, _ := r.entry(e.Route) // valid, it was checked when the route was added.
+		next[id] = entry
+	}
+	r.apply(next)
+}
+
+// Routes lists the current routes, sorted by protocol.
+func (r *Router) Routes() []Route {
+	table := r.current()
+	out := make([]Route, 0, len(table))
+	for _, e := range table {
+		out = append(out, e.Route)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Method.Protocol < out[j].Method.Protocol
+	})
+	return out
+}
+
+// Close removes all routes, and unregisters them from the host.
+func (r *Router) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.apply(routeTable{})
+}
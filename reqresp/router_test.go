@@ -0,0 +1,124 @@
+package reqresp
+
+import (
+	"context"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/view"
+	"reflect"
+	"testing"
+)
+
+// serveUint responds to uint64 requests with the given value.
+func serveUint(v uint64) OnRequestListener {
+	return func(ctx context.Context, peerId peer.ID, handler ChunkedRequestHandler) {
+		var req view.Uint64View
+		if err := handler.ReadRequest(&req); err != nil {
+			_ = handler.WriteErrorChunk(InvalidReqCode, "bad request")
+			return
+		}
+		_ = handler.StreamSSZ(SuccessCode, nil, view.Uint64View(v))
+	}
+}
+
+// requestUint sends the uint64 request, and returns the single uint64 response.
+func requestUint(ctx context.Context, m *Method, newStreamFn NewStreamFn, peerId peer.ID, req uint64) (uint64, error) {
+	var out view.Uint64View
+	received := false
+	err := m.RunRequest(ctx, newStreamFn, peerId, view.Uint64View(req), 1, func(chunk ChunkedResponseHandler) error {
+		if chunk.ResultCode() != SuccessCode {
+			return chunk.ReadErr()
+		}
+		received = true
+		return chunk.ReadObj(func(contextBytes []byte) (codec.Deserializable, error) {
+			return &out, nil
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+	if !received {
+		return 0, fmt.Errorf("peer did not respond to %s", m.Protocol)
+	}
+	return uint64(out), nil
+}
+
+func TestRouter(t *testing.T) {
+	server, client := testPeers(t)
+	router := NewRouter(server, context.Background)
+
+	a, b, c := testMethod("a"), testMethod("b"), testMethod("c")
+	ctx := context.Background()
+	expectResponse := func(m *Method, expected uint64) {
+		t.Helper()
+		got, err := requestUint(ctx, m, client.NewStream, server.ID(), 1)
+		if err != nil {
+			t.Fatalf("request %s failed: %v", m.Protocol, err)
+		}
+		if got != expected {
+			t.Fatalf("expected %s response %d, got %d", m.Protocol, expected, got)
+		}
+	}
+	expectNoResponse := func(m *Method) {
+		t.Helper()
+		if _, err := requestUint(ctx, m, client.NewStream, server.ID(), 1); err == nil {
+			t.Fatalf("expected %s not to be served", m.Protocol)
+		}
+	}
+	expectProtocols := func(expected ...protocol.ID) {
+		t.Helper()
+		var got []protocol.ID
+		for _, route := range router.Routes() {
+			got = append(got, route.Method.Protocol)
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Fatalf("expected routes %v, got %v", expected, got)
+		}
+	}
+
+	if err := router.Reconfigure([]Route{
+		{Method: &b, Listener: serveUint(123)},
+		{Method: &a, Listener: serveUint(42)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	expectProtocols(a.Protocol, b.Protocol)
+	expectResponse(&a, 42)
+	expectResponse(&b, 123)
+
+	// invalid configurations are not applied
+	if err := router.Reconfigure([]Route{
+		{Method: &b, Listener: serveUint(456)},
+		{Method: &b, Listener: serveUint(456)},
+	}); err == nil {
+		t.Error("expected duplicate routes to be invalid")
+	}
+	if err := router.Reconfigure([]Route{{Method: &b}}); err == nil {
+		t.Error("expected route without listener to be invalid")
+	}
+	expectProtocols(a.Protocol, b.Protocol)
+
+	// switch to a different listener, and stop serving a
+	if err := router.Reconfigure([]Route{
+		{Method: &b, Listener: serveUint(456)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	expectProtocols(b.Protocol)
+	expectResponse(&b, 456)
+	expectNoResponse(&a)
+
+	if err := router.Handle(&c, serveUint(7)); err != nil {
+		t.Fatal(err)
+	}
+	expectResponse(&c, 7)
+
+	router.Remove(b.Protocol)
+	expectNoResponse(&b)
+
+	router.Close()
+	expectProtocols()
+	expectNoResponse(&c)
+}
@@ -0,0 +1,139 @@
+package reqresp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/protolambda/ztyp/codec"
+)
+
+// SSZ is an object that can be both encoded and decoded.
+type SSZ interface {
+	codec.Serializable
+	codec.Deserializable
+}
+
+// Sender sends typed response chunks.
+type Sender[Resp SSZ] interface {
+	// Send writes the response as success response chunk.
+	Send(resp Resp) error
+}
+
+// TypedHandler handles a typed request, and responds with the sender.
+// An *ErrorResponse error is written as error response chunk with its code,
+// any other error is written as server error.
+type TypedHandler[Req SSZ, Resp SSZ] func(ctx context.Context, peerId peer.ID, req Req, sender Sender[Resp]) error
+
+// TypedMethod is a Method with typed requests and responses.
+type TypedMethod[Req SSZ, Resp SSZ] struct {
+	*Method
+	// NewStream opens the streams to request with.
+	NewStream NewStreamFn
+	// NewRequest creates an empty request, to decode a request into when serving.
+	NewRequest func() Req
+	// NewResponse creates an empty response for the <context-bytes> of a response chunk, to decode the chunk into.
+	NewResponse func(contextBytes []byte) (Resp, error)
+	// ResponseContext determines the <context-bytes> of a response when serving. Optional, no context-bytes if nil.
+	ResponseContext func(resp Resp) ([]byte, error)
+	// ResponseChunks determines the max number of response chunks of a request,
+	// both when requesting and when serving. Optional if the method has a MaxResponseChunks to apply instead.
+	ResponseChunks func(req Req) uint64
+	// StreamCtx creates the context of served streams. Optional, context.Background if nil.
+	StreamCtx StreamCtxFn
+}
+
+// Request sends the request to the peer, and decodes the response chunks.
+// The responses received before any error are returned, along with the error.
+// An error response chunk is returned as *ErrorResponse.
+func (m *TypedMethod[Req, Resp]) Request(ctx context.Context, peerId peer.ID, req Req) ([]Resp, error) {
+	var maxChunks uint64
+	if m.ResponseChunks != nil {
+		maxChunks = m.ResponseChunks(req)
+	} else if m.Method.MaxResponseChunks != nil {
+		maxChunks = MethodResponseChunks
+	} else {
+		return nil, fmt.Errorf("typed method %s does not limit its response chunks", m.Method.Protocol)
+	}
+	var out []Resp
+	err := m.Method.RunRequest(ctx, m.NewStream, peerId, req, maxChunks, func(chunk ChunkedResponseHandler) error {
+		if chunk.ResultCode() != SuccessCode {
+			return chunk.ReadErr()
+		}
+		var resp Resp
+		err := chunk.ReadObj(func(contextBytes []byte) (codec.Deserializable, error) {
+			r, err := m.NewResponse(contextBytes)
+			resp = r
+			return r, err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to decode response chunk %d: %v", chunk.ChunkIndex(), err)
+		}
+		out = append(out, resp)
+		return nil
+	})
+	return out, err
+}
+
+type typedSender[Resp SSZ] struct {
+	handler ChunkedRequestHandler
+	context func(resp Resp) ([]byte, error)
+	// if the number of responses is limited, by the ResponseChunks of the typed method.
+	limited   bool
+	maxChunks uint64
+	// the number of responses sent
+	chunks uint64
+}
+
+func (s *typedSender[Resp]) Send(resp Resp) error {
+	if s.limited && s.chunks >= s.maxChunks {
+		return fmt.Errorf("the request allows only %d response chunks", s.maxChunks)
+	}
+	var contextBytes []byte
+	if s.context != nil {
+		var err error
+		contextBytes, err = s.context(resp)
+		if err != nil {
+			return fmt.Errorf("failed to determine context-bytes of response: %v", err)
+		}
+	}
+	if err := s.handler.StreamSSZ(SuccessCode, contextBytes, resp); err != nil {
+		return err
+	}
+	s.chunks++
+	return nil
+}
+
+// Serve builds a stream handler that decodes requests, and serves them with the typed handler.
+// Methods without request data are served with an empty request from NewRequest.
+// Responses beyond the ResponseChunks of the request, if any, fail to send.
+func (m *TypedMethod[Req, Resp]) Serve(handle TypedHandler[Req, Resp]) network.StreamHandler {
+	newCtx := m.StreamCtx
+	if newCtx == nil {
+		newCtx = context.Background
+	}
+	return m.Method.MakeStreamHandler(newCtx, func(ctx context.Context, peerId peer.ID, handler ChunkedRequestHandler) {
+		req := m.NewRequest()
+		if m.Method.RequestMinMax.Max > 0 {
+			if err := handler.ReadRequest(req); err != nil {
+				_ = handler.WriteErrorChunk(InvalidReqCode, fmt.Sprintf("could not parse request: %v", err))
+				return
+			}
+		}
+		sender := &typedSender[Resp]{handler: handler, context: m.ResponseContext}
+		if m.ResponseChunks != nil {
+			sender.limited = true
+			sender.maxChunks = m.ResponseChunks(req)
+		}
+		err := handle(ctx, peerId, req, sender)
+		if err != nil {
+			var errResp *ErrorResponse
+			if errors.As(err, &errResp) {
+				_ = handler.WriteErrorChunk(errResp.Code, errResp.Msg)
+			} else {
+				_ = handler.WriteErrorChunk(ServerErrCode, err.Error())
+			}
+		}
+	})
+}
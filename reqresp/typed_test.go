@@ -0,0 +1,131 @@
+package reqresp
+
+import (
+	"context"
+	"errors"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/protolambda/ztyp/view"
+	"reflect"
+	"testing"
+)
+
+// testTypedMethod is a typed testMethod, responding with up to the requested count of chunks.
+func testTypedMethod(name string, newStream NewStreamFn) *TypedMethod[*view.Uint64View, *view.Uint64View] {
+	m := testMethod(name)
+	return &TypedMethod[*view.Uint64View, *view.Uint64View]{
+		Method:    &m,
+		NewStream: newStream,
+		NewRequest: func() *view.Uint64View {
+			return new(view.Uint64View)
+		},
+		NewResponse: func(contextBytes []byte) (*view.Uint64View, error) {
+			return new(view.Uint64View), nil
+		},
+		ResponseChunks: func(req *view.Uint64View) uint64 {
+			return uint64(*req)
+		},
+	}
+}
+
+func TestTypedMethod(t *testing.T) {
+	server, client := testPeers(t)
+
+	// Counts up to the requested number, and fails at 5, after sending the preceding numbers.
+	// One more response than requested is attempted, which is not sent.
+	m := testTypedMethod("count", client.NewStream)
+	extra := make(chan error, 1)
+	server.SetStreamHandler(m.Protocol, m.Serve(func(ctx context.Context, peerId peer.ID, req *view.Uint64View, sender Sender[*view.Uint64View]) error {
+		for i := view.Uint64View(0); i < *req; i++ {
+			if i == 5 {
+				return &ErrorResponse{Code: ResourceUnavailableCode, Msg: "too far"}
+			}
+			resp := i
+			if err := sender.Send(&resp); err != nil {
+				return err
+			}
+		}
+		extra <- sender.Send(req)
+		return nil
+	}))
+
+	ctx := context.Background()
+	req := view.Uint64View(3)
+	out, err := m.Request(ctx, server.ID(), &req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 3 {
+		t.Fatalf("expected 3 responses, got %d", len(out))
+	}
+	for i, resp := range out {
+		if *resp != view.Uint64View(i) {
+			t.Errorf("response %d: unexpected value %d", i, *resp)
+		}
+	}
+	if err := <-extra; err == nil {
+		t.Error("expected the response beyond the response chunks of the request not to be sent")
+	}
+
+	req = 7
+	out, err = m.Request(ctx, server.ID(), &req)
+	if len(out) != 5 {
+		t.Errorf("expected 5 responses, got %d", len(out))
+	}
+	var errResp *ErrorResponse
+	if !errors.As(err, &errResp) || !reflect.DeepEqual(errResp, &ErrorResponse{Code: ResourceUnavailableCode, Msg: "too far"}) {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// without a limit of the typed method or the method, requests are not sent
+	unlimited := testTypedMethod("unlimited", client.NewStream)
+	unlimited.ResponseChunks = nil
+	if _, err := unlimited.Request(ctx, server.ID(), &req); err == nil {
+		t.Error("expected request without response chunk limit to fail")
+	}
+}
+
+func TestTypedMethodNoRequest(t *testing.T) {
+	server, client := testPeers(t)
+
+	// a method without request data, like metadata
+	uintSize := MinMaxSize{Min: 8, Max: 8}
+	m := &TypedMethod[*emptyReq, *view.Uint64View]{
+		Method: &Method{
+			Protocol:      "/eth2/test/req/empty/1/ssz_snappy",
+			RequestMinMax: MinMaxSize{Min: 0, Max: 0},
+			Compression:   SnappyCompression{},
+			ReadContextBytes: func(blr *BufLimitReader) ([]byte, MinMaxSize, error) {
+				return nil, uintSize, nil
+			},
+			MaxResponseChunks: SingleResponseChunk,
+		},
+		NewStream: client.NewStream,
+		NewRequest: func() *emptyReq {
+			return new(emptyReq)
+		},
+		NewResponse: func(contextBytes []byte) (*view.Uint64View, error) {
+			return new(view.Uint64View), nil
+		},
+	}
+	ours := view.Uint64View(42)
+	served := make(chan error, 1)
+	server.SetStreamHandler(m.Protocol, m.Serve(func(ctx context.Context, peerId peer.ID, req *emptyReq, sender Sender[*view.Uint64View]) error {
+		if err := sender.Send(&ours); err != nil {
+			return err
+		}
+		// the method responds with a single chunk, also without a request to read
+		served <- sender.Send(&ours)
+		return nil
+	}))
+
+	out, err := m.Request(context.Background(), server.ID(), new(emptyReq))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || *out[0] != ours {
+		t.Errorf("unexpected responses %v", out)
+	}
+	if err := <-served; err == nil {
+		t.Error("expected the second response not to be sent")
+	}
+}